@@ -12,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
 	"github.com/aws/smithy-go"
 )
 
@@ -24,6 +25,7 @@ var (
 		integTest_getSecretString,
 		integTest_getSecretStringWithStage,
 		integTest_getSecretStringWithTTL,
+		integTest_getSecretStringWithFakeClockTTL,
 		integTest_getSecretStringNoSecret,
 	}
 )
@@ -380,6 +382,79 @@ func integTest_getSecretStringWithTTL(t *testing.T, api secretcache.SecretsManag
 	return *createResult.ARN
 }
 
+func integTest_getSecretStringWithFakeClockTTL(t *testing.T, api secretcache.SecretsManagerAPIClient) string {
+	ttl := time.Second * 2
+	clock := secretcachetest.NewFakeClock(time.Now())
+	cache, _ := secretcache.New(
+		func(c *secretcache.Cache) { c.Client = api },
+		secretcache.WithTTL(ttl),
+		secretcache.WithClock(clock),
+	)
+
+	secretString := "This is a secret"
+	createResult, err := createSecret("getSecretStringWithFakeClockTTL", &secretString, nil, api)
+
+	if err != nil {
+		t.Errorf("Failed to create secret: \"getSecretStringWithFakeClockTTL\" ERROR: %s", err)
+		return ""
+	}
+
+	resultString, err := cache.GetSecretString(*createResult.ARN)
+
+	if err != nil {
+		t.Error(err)
+		return *createResult.ARN
+	}
+
+	if secretString != resultString {
+		t.Errorf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, resultString)
+		return *createResult.ARN
+	}
+
+	updatedSecretString := "This is v2 secret string"
+	updatedRequestToken := generateRandString(32)
+	_, err = api.UpdateSecret(
+		context.TODO(),
+		&secretsmanager.UpdateSecretInput{
+			SecretId:           createResult.ARN,
+			SecretString:       &updatedSecretString,
+			ClientRequestToken: &updatedRequestToken,
+		})
+
+	if err != nil {
+		t.Errorf("Failed to update secret: \"%s\" ERROR: %s", *createResult.ARN, err)
+		return *createResult.ARN
+	}
+
+	resultString, err = cache.GetSecretString(*createResult.ARN)
+
+	if err != nil {
+		t.Error(err)
+		return *createResult.ARN
+	}
+
+	if secretString != resultString {
+		t.Errorf("Expected cached secret to be same as previous version - \"%s\", \"%s\"", resultString, secretString)
+		return *createResult.ARN
+	}
+
+	clock.Advance(ttl)
+
+	resultString, err = cache.GetSecretString(*createResult.ARN)
+
+	if err != nil {
+		t.Error(err)
+		return *createResult.ARN
+	}
+
+	if updatedSecretString != resultString {
+		t.Errorf("Expected cached secret to be same as updated version - \"%s\", \"%s\"", resultString, updatedSecretString)
+		return *createResult.ARN
+	}
+
+	return *createResult.ARN
+}
+
 func integTest_getSecretStringNoSecret(t *testing.T, api secretcache.SecretsManagerAPIClient) string {
 	cache, _ := secretcache.New(
 		func(c *secretcache.Cache) { c.Client = api },
@@ -0,0 +1,187 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/smithy-go"
+)
+
+// The maximum number of secret ids in a single BatchGetSecretValue request.
+const batchGetSecretValueMaxIds = 20
+
+// GetSecrets gets the secret values for the given secret ids and the configured version stage.
+// Secrets that are not cached, or whose cached value has expired, are fetched together with
+// BatchGetSecretValue when the client supports it.
+// Returns the values found, keyed by secret id, and a *BatchError listing the secrets that failed.
+func (c *Cache) GetSecrets(ctx context.Context, secretIds []string) (map[string]*secretsmanager.GetSecretValueOutput, error) {
+	var stale []string
+	for _, secretId := range secretIds {
+		if c.getCachedSecret(secretId).isStale(ctx, "") {
+			stale = append(stale, secretId)
+		}
+	}
+
+	if _, ok := c.Client.(BatchGetSecretValueAPIClient); ok && len(stale) > 0 {
+		// Failures are recorded on the cache items and reported below.
+		_ = c.Prefetch(ctx, stale)
+	}
+
+	results := make(map[string]*secretsmanager.GetSecretValueOutput, len(secretIds))
+	errs := make(map[string]error)
+
+	for _, secretId := range secretIds {
+		result, err := c.getCachedSecret(secretId).getSecretValue(ctx, "")
+
+		if err != nil {
+			errs[secretId] = err
+			continue
+		}
+
+		results[secretId] = result
+	}
+
+	return results, newBatchError(errs)
+}
+
+// Prefetch loads the given secrets into the cache, along with every secret matching the
+// filters, using BatchGetSecretValue. Only the versions returned by the batch call, usually
+// AWSCURRENT, are cached; other stages are fetched on first use.
+// Clients that do not implement BatchGetSecretValueAPIClient fall back to one lookup per secret
+// id and cannot prefetch by filter.
+// Batch calls go through the cache's rate limit, circuit breaker, concurrency limit and hedging.
+// Returns a *BatchError listing the secrets that could not be loaded, in which the failure
+// of a call for the filters as a whole is keyed by an empty secret id.
+func (c *Cache) Prefetch(ctx context.Context, secretIds []string, filters ...types.Filter) error {
+	if _, ok := c.Client.(BatchGetSecretValueAPIClient); !ok {
+		if len(filters) > 0 {
+			return &InvalidOperationError{
+				baseError{
+					Message: "client does not support BatchGetSecretValue, cannot prefetch by filter",
+				},
+			}
+		}
+
+		errs := make(map[string]error)
+		for _, secretId := range secretIds {
+			if _, err := c.getCachedSecret(secretId).getSecretValue(ctx, ""); err != nil {
+				errs[secretId] = err
+			}
+		}
+
+		return newBatchError(errs)
+	}
+
+	errs := make(map[string]error)
+
+	for start := 0; start < len(secretIds); start += batchGetSecretValueMaxIds {
+		end := min(start+batchGetSecretValueMaxIds, len(secretIds))
+		chunk := secretIds[start:end]
+
+		err := c.batchGetSecretValue(ctx, &secretsmanager.BatchGetSecretValueInput{SecretIdList: chunk}, chunk, errs)
+
+		if err != nil {
+			for _, secretId := range chunk {
+				if _, failed := errs[secretId]; !failed {
+					errs[secretId] = err
+				}
+			}
+		}
+	}
+
+	if len(filters) > 0 {
+		input := &secretsmanager.BatchGetSecretValueInput{
+			Filters:    filters,
+			MaxResults: aws.Int32(batchGetSecretValueMaxIds),
+		}
+
+		if err := c.batchGetSecretValue(ctx, input, nil, errs); err != nil {
+			errs[""] = err
+		}
+	}
+
+	return newBatchError(errs)
+}
+
+// batchGetSecretValue pages through BatchGetSecretValue and seeds the cache with the results.
+// Values are cached under the requested secret id they match, or under their name.
+// Errors for individual secrets, and secrets returned without a version id, are added to errs.
+// Returns an error if a batch call fails as a whole.
+func (c *Cache) batchGetSecretValue(
+	ctx context.Context, input *secretsmanager.BatchGetSecretValueInput, requested []string, errs map[string]error,
+) error {
+	for {
+		output, err := callBatchGetSecretValue(ctx, c.client, input)
+
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range output.SecretValues {
+			secretId := matchSecretId(requested, entry.Name, entry.ARN)
+			if entry.VersionId == nil {
+				errs[secretId] = &VersionNotFoundError{
+					baseError{
+						Message: fmt.Sprintf("BatchGetSecretValue returned secret %s without a version id", secretId),
+					},
+				}
+				continue
+			}
+
+			c.getCachedSecret(secretId).seed(ctx, &secretsmanager.GetSecretValueOutput{
+				ARN:           entry.ARN,
+				CreatedDate:   entry.CreatedDate,
+				Name:          entry.Name,
+				SecretBinary:  entry.SecretBinary,
+				SecretString:  entry.SecretString,
+				VersionId:     entry.VersionId,
+				VersionStages: entry.VersionStages,
+			})
+		}
+
+		for _, apiErr := range output.Errors {
+			secretId := aws.ToString(apiErr.SecretId)
+			err := &smithy.GenericAPIError{
+				Code:    aws.ToString(apiErr.ErrorCode),
+				Message: aws.ToString(apiErr.Message),
+			}
+
+			c.getCachedSecret(secretId).seedError(err)
+			errs[secretId] = err
+		}
+
+		if output.NextToken == nil {
+			return nil
+		}
+
+		input.NextToken = output.NextToken
+	}
+}
+
+// matchSecretId returns the requested secret id that refers to a secret by its name or ARN,
+// or the name if none does.
+func matchSecretId(requested []string, name *string, arn *string) string {
+	for _, secretId := range requested {
+		if secretId == aws.ToString(name) || secretId == aws.ToString(arn) {
+			return secretId
+		}
+	}
+
+	return aws.ToString(name)
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+	"github.com/aws/smithy-go"
+)
+
+func TestGetSecretsBatch(t *testing.T) {
+	mockClient := newMockedBatchClient(45)
+	secretCache, _ := secretcache.New(secretcache.WithClient(mockClient))
+
+	var secretIds []string
+	for i := 0; i < 45; i++ {
+		secretIds = append(secretIds, "secret-"+strconv.Itoa(i))
+	}
+
+	for round := 0; round < 2; round++ {
+		results, err := secretCache.GetSecrets(context.Background(), secretIds)
+
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+
+		for _, secretId := range secretIds {
+			if result, found := results[secretId]; !found || *result.SecretString != "value of "+secretId {
+				t.Fatalf("Expected the value of %s to be returned", secretId)
+			}
+		}
+	}
+
+	if mockClient.BatchGetSecretValueCallCount != 3 {
+		t.Fatalf("Expected three calls to BatchGetSecretValue API, got %d", mockClient.BatchGetSecretValueCallCount)
+	}
+
+	if mockClient.DescribeSecretCallCount != 0 || mockClient.GetSecretValueCallCount != 0 {
+		t.Fatalf("Expected no single secret calls, got %d DescribeSecret and %d GetSecretValue",
+			mockClient.DescribeSecretCallCount, mockClient.GetSecretValueCallCount)
+	}
+
+	if result, err := secretCache.GetSecretString("secret-7"); err != nil || result != "value of secret-7" {
+		t.Fatalf("Expected a prefetched secret to be served from cache")
+	}
+
+	if mockClient.DescribeSecretCallCount != 0 || mockClient.GetSecretValueCallCount != 0 {
+		t.Fatalf("Expected no single secret calls for a prefetched secret")
+	}
+}
+
+func TestGetSecretsPartialFailure(t *testing.T) {
+	mockClient := newMockedBatchClient(2)
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(mockClient),
+		secretcache.WithClock(secretcachetest.NewFakeClock(time.Now())),
+	)
+
+	results, err := secretCache.GetSecrets(context.Background(), []string{"secret-0", "missing", "secret-1"})
+
+	var batchErr *secretcache.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a BatchError, got %v", err)
+	}
+
+	if len(batchErr.Errors) != 1 {
+		t.Fatalf("Expected a single failed secret, got %v", batchErr.Errors)
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(batchErr.Errors["missing"], &apiErr) || apiErr.ErrorCode() != "ResourceNotFoundException" {
+		t.Fatalf("Expected ResourceNotFoundException for the missing secret, got %v", batchErr.Errors["missing"])
+	}
+
+	if len(results) != 2 || results["secret-0"] == nil || results["secret-1"] == nil {
+		t.Fatalf("Expected the other secrets to be returned, got %v", results)
+	}
+
+	// The failure is cached like any other failed refresh.
+	if _, err := secretCache.GetSecretString("missing"); !errors.As(err, &apiErr) {
+		t.Fatalf("Expected the batch error for the missing secret, got %v", err)
+	}
+
+	if mockClient.DescribeSecretCallCount != 0 {
+		t.Fatalf("Expected the failed secret to back off, got %d DescribeSecret calls", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestGetSecretsWithoutBatchSupport(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	results, err := secretCache.GetSecrets(context.Background(), []string{secretId})
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if *results[secretId].SecretString != secretString {
+		t.Fatalf("Expected and result secret string are different")
+	}
+
+	err = secretCache.Prefetch(context.Background(), nil, types.Filter{Key: types.FilterNameStringTypeName, Values: []string{"secret"}})
+
+	var opErr *secretcache.InvalidOperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Expected an InvalidOperationError prefetching by filter, got %v", err)
+	}
+}
+
+func TestPrefetchFilters(t *testing.T) {
+	mockClient := newMockedBatchClient(30)
+	secretCache, _ := secretcache.New(secretcache.WithClient(mockClient))
+
+	err := secretCache.Prefetch(context.Background(), nil, types.Filter{Key: types.FilterNameStringTypeName, Values: []string{"secret-"}})
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if mockClient.BatchGetSecretValueCallCount != 2 {
+		t.Fatalf("Expected two pages of BatchGetSecretValue, got %d", mockClient.BatchGetSecretValueCallCount)
+	}
+
+	for i := 0; i < 30; i++ {
+		secretId := "secret-" + strconv.Itoa(i)
+		if result, err := secretCache.GetSecretString(secretId); err != nil || result != "value of "+secretId {
+			t.Fatalf("Expected %s to be prefetched", secretId)
+		}
+	}
+
+	if mockClient.DescribeSecretCallCount != 0 || mockClient.GetSecretValueCallCount != 0 {
+		t.Fatalf("Expected prefetched secrets to be served from cache")
+	}
+
+	// Stages that were not prefetched are looked up as usual.
+	if _, err := secretCache.GetSecretStringWithStage("secret-0", "AWSPREVIOUS"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if mockClient.DescribeSecretCallCount != 1 {
+		t.Fatalf("Expected DescribeSecret for a stage that was not prefetched, got %d", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestPrefetchBatchCallFailure(t *testing.T) {
+	mockClient := newMockedBatchClient(2)
+	mockClient.BatchGetSecretValueErr = errors.New("serviceUnavailable")
+	secretCache, _ := secretcache.New(secretcache.WithClient(mockClient))
+
+	err := secretCache.Prefetch(context.Background(), []string{"secret-0", "secret-1"})
+
+	var batchErr *secretcache.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Fatalf("Expected both secrets to be reported as failed, got %v", err)
+	}
+}
+
+func TestPrefetchFilterCallFailure(t *testing.T) {
+	mockClient := newMockedBatchClient(2)
+	secretCache, _ := secretcache.New(secretcache.WithClient(&failingFilterClient{mockClient}))
+
+	err := secretCache.Prefetch(context.Background(), []string{"secret-0", "unknown"}, types.Filter{Key: types.FilterNameStringTypeName, Values: []string{"secret-"}})
+
+	var batchErr *secretcache.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Fatalf("Expected the unknown secret and the filters to be reported as failed, got %v", err)
+	}
+
+	if _, found := batchErr.Errors["unknown"]; !found || batchErr.Errors[""] == nil {
+		t.Fatalf("Expected errors for the unknown secret and the filters, got %v", batchErr.Errors)
+	}
+}
+
+func TestPrefetchWithoutVersionId(t *testing.T) {
+	mockClient := newMockedBatchClient(2)
+	entry := mockClient.MockedSecrets["secret-1"]
+	entry.VersionId = nil
+	mockClient.MockedSecrets["secret-1"] = entry
+	secretCache, _ := secretcache.New(secretcache.WithClient(mockClient))
+
+	err := secretCache.Prefetch(context.Background(), []string{"secret-0", "secret-1"})
+
+	var batchErr *secretcache.BatchError
+	var versionErr *secretcache.VersionNotFoundError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 1 || !errors.As(batchErr.Errors["secret-1"], &versionErr) {
+		t.Fatalf("Expected the secret without a version id to be reported as failed, got %v", err)
+	}
+}
+
+func TestPrefetchUsesCircuitBreaker(t *testing.T) {
+	mockClient := newMockedBatchClient(2)
+	mockClient.BatchGetSecretValueErr = newServerError(http.StatusServiceUnavailable)
+	secretCache, _ := secretcache.New(secretcache.WithClient(mockClient), secretcache.WithCircuitBreaker(1, time.Hour))
+
+	_ = secretCache.Prefetch(context.Background(), []string{"secret-0"})
+	err := secretCache.Prefetch(context.Background(), []string{"secret-0"})
+
+	var circuitErr *secretcache.CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("Expected a CircuitOpenError, got %v", err)
+	}
+
+	if mockClient.BatchGetSecretValueCallCount != 1 {
+		t.Fatalf("Expected the open circuit to skip BatchGetSecretValue, got %d calls", mockClient.BatchGetSecretValueCallCount)
+	}
+}
+
+// A batch client whose calls with filters fail
+type failingFilterClient struct {
+	*mockBatchSecretsManagerClient
+}
+
+func (c *failingFilterClient) BatchGetSecretValue(ctx context.Context, input *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	if len(input.Filters) > 0 {
+		return nil, errors.New("accessDenied")
+	}
+
+	return c.mockBatchSecretsManagerClient.BatchGetSecretValue(ctx, input, optFns...)
+}
@@ -17,6 +17,7 @@ package secretcache
 
 import (
 	"context"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -26,15 +27,26 @@ import (
 
 // Cache client for AWS Secrets Manager secrets.
 type Cache struct {
-	lru *lruCache
+	lru   *lruCache
+	stats *cacheStats
+
+	// The client used by cache items: Client wrapped with the configured
+	// request policies such as hedging.
+	client SecretsManagerAPIClient
+
+	// Closed by Close to stop background goroutines.
+	closed    chan struct{}
+	closeOnce sync.Once
 	CacheConfig
 	Client SecretsManagerAPIClient
 }
 
 // New constructs a secret cache using functional options, uses defaults otherwise.
+// Options may be the With* helpers or functions that set Cache fields directly.
 // Initialises a SecretsManager Client from a new config.LoadDefaultConfig.
 // Initialises CacheConfig to default values.
 // Initialises lru cache with a default max size.
+// Returns an InvalidConfigError if the resulting configuration is not usable.
 func New(optFns ...func(*Cache)) (*Cache, error) {
 
 	cache := &Cache{
@@ -52,8 +64,28 @@ func New(optFns ...func(*Cache)) (*Cache, error) {
 		optFn(cache)
 	}
 
+	//A TTL takes precedence over the default CacheItemTTL
+	if cache.TTL != 0 && cache.CacheItemTTL == DefaultCacheItemTTL {
+		cache.CacheItemTTL = cache.TTL.Nanoseconds()
+	}
+
+	if err := cache.CacheConfig.validate(); err != nil {
+		return nil, err
+	}
+
+	//Share the random source safely between cache items
+	if _, locked := cache.RandSource.(*lockedSource); cache.RandSource != nil && !locked {
+		cache.RandSource = &lockedSource{src: cache.RandSource}
+	}
+	cache.random = cache.CacheConfig.rand()
+
 	//Initialise lru cache
 	cache.lru = newLRUCache(cache.MaxCacheSize)
+	cache.lru.onEvict = func(_ string, data interface{}) {
+		data.(*secretCacheItem).evict(EvictedCapacity)
+	}
+	cache.stats = &cacheStats{}
+	cache.closed = make(chan struct{})
 
 	//Initialise the secrets manager client
 	if cache.Client == nil {
@@ -68,35 +100,78 @@ func New(optFns ...func(*Cache)) (*Cache, error) {
 		cache.Client = secretsmanager.NewFromConfig(cfg)
 	}
 
+	cache.client = cache.Client
+	hedge := cache.HedgeClient
+	if hedge == nil {
+		hedge = cache.Client
+	}
+
+	if cache.RateLimit > 0 {
+		bucket := newTokenBucket(cache.CacheConfig)
+		cache.client = &rateLimitedClient{SecretsManagerAPIClient: cache.client, bucket: bucket}
+		hedge = &rateLimitedClient{SecretsManagerAPIClient: hedge, bucket: bucket}
+	}
+
+	if cache.CircuitBreakerThreshold > 0 {
+		breaker := newCircuitBreaker(cache.CacheConfig, cache.stats)
+		cache.client = &circuitBreakerClient{SecretsManagerAPIClient: cache.client, breaker: breaker}
+		hedge = &circuitBreakerClient{SecretsManagerAPIClient: hedge, breaker: breaker}
+	}
+
+	if cache.MaxConcurrentRequests > 0 {
+		limiter := &concurrencyLimiter{capacity: cache.MaxConcurrentRequests}
+		cache.client = &concurrencyLimitedClient{SecretsManagerAPIClient: cache.client, limiter: limiter}
+		hedge = &concurrencyLimitedClient{SecretsManagerAPIClient: hedge, limiter: limiter}
+	}
+
+	if cache.HedgeDelay > 0 {
+		cache.client = newHedgingClient(cache.client, hedge, cache.CacheConfig, cache.stats)
+	}
+
+	if cache.IdleTimeout > 0 {
+		go cache.sweepIdle()
+	}
+
 	return cache, nil
 }
 
+// Stats returns a snapshot of the cache's counters.
+func (c *Cache) Stats() Stats {
+	return c.stats.snapshot()
+}
+
 // getCachedSecret gets a cached secret for the given secret identifier.
 // Returns cached secret item.
 func (c *Cache) getCachedSecret(secretId string) *secretCacheItem {
 	lruValue, found := c.lru.get(secretId)
 
-	if !found {
-		cacheItem := newSecretCacheItem(c.CacheConfig, c.Client, secretId)
-		c.lru.putIfAbsent(secretId, &cacheItem)
-		lruValue, _ = c.lru.get(secretId)
+	for !found {
+		cacheItem := newSecretCacheItem(c.CacheConfig, c.client, c.stats, secretId)
+		if c.lru.putIfAbsent(secretId, &cacheItem) {
+			c.onInsert(cacheItem.hookInfo())
+			lruValue, found = &cacheItem, true
+		} else {
+			lruValue, found = c.lru.get(secretId)
+		}
 	}
 
 	secretCacheItem, _ := lruValue.(*secretCacheItem)
+	secretCacheItem.lastAccessTime.Store(c.clock().Now().UnixNano())
 	return secretCacheItem
 }
 
-// GetSecretString gets the secret string value from the cache for given secret id and a default version stage.
+// GetSecretString gets the secret string value from the cache for given secret id and the configured version stage.
 // Returns the secret string and an error if operation failed.
 func (c *Cache) GetSecretString(secretId string) (string, error) {
 	return c.GetSecretStringWithContext(context.Background(), secretId)
 }
 
 func (c *Cache) GetSecretStringWithContext(ctx context.Context, secretId string) (string, error) {
-	return c.GetSecretStringWithStageWithContext(ctx, secretId, DefaultVersionStage)
+	return c.GetSecretStringWithStageWithContext(ctx, secretId, "")
 }
 
 // GetSecretStringWithStage gets the secret string value from the cache for given secret id and version stage.
+// An empty version stage selects the configured version stage.
 // Returns the secret string and an error if operation failed.
 func (c *Cache) GetSecretStringWithStage(secretId string, versionStage string) (string, error) {
 	return c.GetSecretStringWithStageWithContext(context.Background(), secretId, versionStage)
@@ -122,17 +197,18 @@ func (c *Cache) GetSecretStringWithStageWithContext(ctx context.Context, secretI
 	return *getSecretValueOutput.SecretString, nil
 }
 
-// GetSecretBinary gets the secret binary value from the cache for given secret id and a default version stage.
+// GetSecretBinary gets the secret binary value from the cache for given secret id and the configured version stage.
 // Returns the secret binary and an error if operation failed.
 func (c *Cache) GetSecretBinary(secretId string) ([]byte, error) {
 	return c.GetSecretBinaryWithContext(context.Background(), secretId)
 }
 
 func (c *Cache) GetSecretBinaryWithContext(ctx context.Context, secretId string) ([]byte, error) {
-	return c.GetSecretBinaryWithStageWithContext(ctx, secretId, DefaultVersionStage)
+	return c.GetSecretBinaryWithStageWithContext(ctx, secretId, "")
 }
 
 // GetSecretBinaryWithStage gets the secret binary value from the cache for given secret id and version stage.
+// An empty version stage selects the configured version stage.
 // Returns the secret binary and an error if operation failed.
 func (c *Cache) GetSecretBinaryWithStage(secretId string, versionStage string) ([]byte, error) {
 	return c.GetSecretBinaryWithStageWithContext(context.Background(), secretId, versionStage)
@@ -158,6 +234,22 @@ func (c *Cache) GetSecretBinaryWithStageWithContext(ctx context.Context, secretI
 	return getSecretValueOutput.SecretBinary, nil
 }
 
+// BorrowSecret calls fn with the secret for the given secret id and the configured version stage:
+// its SecretBinary, or the bytes of its SecretString if it has no binary.  The secret is only valid
+// until fn returns and must not be modified.  With CacheConfig.SecureMemory set and no hook, fn sees
+// the cached buffer itself; otherwise it sees a copy that is wiped when fn returns.  Lookups of the
+// same secret wait for fn to return.
+// Returns the lookup error, or the error returned by fn.
+func (c *Cache) BorrowSecret(ctx context.Context, secretId string, fn func(secret []byte) error) error {
+	return c.BorrowSecretWithStage(ctx, secretId, "", fn)
+}
+
+// BorrowSecretWithStage is BorrowSecret for the given version stage.
+// An empty version stage selects the configured version stage.
+func (c *Cache) BorrowSecretWithStage(ctx context.Context, secretId string, versionStage string, fn func(secret []byte) error) error {
+	return c.getCachedSecret(secretId).borrowSecret(ctx, versionStage, fn)
+}
+
 // Method to force the refresh of a secret inside the cache
 func (c *Cache) RefreshNow(secretId string) {
 	c.RefreshNowWithContext(context.Background(), secretId)
@@ -167,3 +259,16 @@ func (c *Cache) RefreshNowWithContext(ctx context.Context, secretId string) {
 	secretCacheItem := c.getCachedSecret(secretId)
 	secretCacheItem.refreshNow(ctx)
 }
+
+// RefreshCached forces the refresh of a secret like RefreshNow, but only if it is
+// cached: unlike RefreshNow, it never adds the secret to the cache.
+// Returns whether the secret was cached.
+func (c *Cache) RefreshCached(ctx context.Context, secretId string) bool {
+	data, found := c.lru.peek(secretId)
+	if !found {
+		return false
+	}
+
+	data.(*secretCacheItem).refreshNow(ctx)
+	return true
+}
@@ -13,10 +13,33 @@
 
 package secretcache
 
+import (
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultMaxCacheSize         = 1024
+	DefaultMaxVersionsPerSecret = 10
+	DefaultCacheItemTTL         = 3600000000000 // 1 hour in nanoseconds
+	DefaultVersionStage         = "AWSCURRENT"
+)
+
+// DeletedSecretPolicy decides how the cache treats secrets scheduled for deletion.
+type DeletedSecretPolicy int
+
 const (
-	DefaultMaxCacheSize = 1024
-	DefaultCacheItemTTL = 3600000000000 // 1 hour in nanoseconds
-	DefaultVersionStage = "AWSCURRENT"
+	// DeletedSecretServe keeps serving the cached value.
+	DeletedSecretServe DeletedSecretPolicy = iota
+
+	// DeletedSecretWarn keeps serving the cached value and logs a warning each
+	// time the secret is refreshed.
+	DeletedSecretWarn
+
+	// DeletedSecretFail fails lookups with a *SecretDeletedError until the
+	// secret is restored.
+	DeletedSecretFail
 )
 
 // CacheConfig is the config object passed to the Cache struct
@@ -25,16 +48,367 @@ type CacheConfig struct {
 	//have not been accessed recently.
 	MaxCacheSize int
 
+	//The maximum number of versions cached for each secret before evicting
+	//versions that have not been accessed recently.  Defaults to
+	//DefaultMaxVersionsPerSecret when zero.
+	MaxVersionsPerSecret int
+
 	//The number of nanoseconds that a cached item is considered valid before
 	// requiring a refresh of the secret state.  Items that have exceeded this
 	// TTL will be refreshed synchronously when requesting the secret value.  If
 	// the synchronous refresh failed, the stale secret will be returned.
+	// TTL is the time.Duration equivalent and is preferred for new code.
 	CacheItemTTL int64
 
+	//The time that a cached item is considered valid before requiring a
+	//refresh of the secret state.  Takes the place of CacheItemTTL, and of
+	//the DefaultCacheItemTTL New sets it to; setting both to different
+	//values otherwise is a configuration error.
+	TTL time.Duration
+
 	//The version stage that will be used when requesting the secret values for
-	//this cache.
+	//this cache.  Lookups that name a version stage explicitly override it.
+	//Defaults to DefaultVersionStage when empty.
 	VersionStage string
 
+	//When true, values are looked up with GetSecretValue by version stage and
+	//DescribeSecret is only called if a response does not identify its version.
+	//Halves the API calls of a cold lookup and does not need the
+	//secretsmanager:DescribeSecret permission.  Each stage is refreshed
+	//separately once its TTL expires.
+	DirectStageLookup bool
+
+	//What to do with a secret that DescribeSecret reports as scheduled for
+	//deletion or, with DirectStageLookup, whose GetSecretValue fails because it
+	//is.  Defaults to DeletedSecretServe.
+	DeletedSecretPolicy DeletedSecretPolicy
+
 	//Used to hook in-memory cache updates.
 	Hook CacheHook
+
+	//Used to hook in-memory cache updates, with context and errors.  Takes the
+	//place of Hook; setting both is a configuration error.
+	HookV2 CacheHookV2
+
+	//Used to report cache activity such as failed refreshes.  Nothing is
+	//logged when unset.
+	Logger *slog.Logger
+
+	//The source of time used for expiry and backoff.  Defaults to the
+	//system clock.
+	Clock Clock
+
+	//The source of randomness used for refresh jitter.  Calls into the source
+	//are serialised by the cache, so a source from rand.NewSource can be used
+	//directly.  Seeding it makes the refresh schedule reproducible.  Defaults
+	//to the global math/rand source.
+	RandSource rand.Source
+
+	//Decides how refresh times are spread out.  Defaults to EqualJitter.
+	Jitter JitterStrategy
+
+	//Adjusts refresh times to each secret's metadata, for example its rotation
+	//schedule with RotationAwareScheduler.  When unset, secrets are refreshed
+	//after the jittered TTL.
+	Scheduler RefreshScheduler
+
+	//When positive, a GetSecretValue, DescribeSecret or BatchGetSecretValue call
+	//that has not answered within this delay is sent a second time, and the first response
+	//wins.  Trades extra API calls for lower tail latency.
+	HedgeDelay time.Duration
+
+	//The client the second, hedged, call is sent to, for example a client for
+	//a replica region.  Defaults to the cache's Client.  When it is an AWS SDK
+	//client, secret ARNs are rewritten for its region.  Requires HedgeDelay.
+	HedgeClient SecretsManagerAPIClient
+
+	//When positive, the maximum sustained number of GetSecretValue,
+	//DescribeSecret and BatchGetSecretValue calls per second made by the cache, including hedged
+	//calls.  Calls over the limit wait for their turn, except refreshes of
+	//cached values, which keep serving the cached value and retry later.
+	RateLimit float64
+
+	//The number of calls that can be made at once before RateLimit applies.
+	//Defaults to RateLimit rounded up, and at least 1.  Requires RateLimit.
+	RateBurst int
+
+	//When positive, the number of consecutive failed calls, across all
+	//secrets, after which the circuit breaker opens.  While it is open, cached
+	//values are served without calling AWS Secrets Manager and lookups of
+	//secrets that are not cached fail with a *CircuitOpenError.  Timeouts,
+	//network errors and 5xx errors count as failures.
+	CircuitBreakerThreshold int
+
+	//How long the circuit breaker stays open before letting a trial call
+	//through.  Defaults to DefaultCircuitBreakerCooldown.  Requires
+	//CircuitBreakerThreshold.
+	CircuitBreakerCooldown time.Duration
+
+	//When positive, the maximum number of GetSecretValue, DescribeSecret and
+	//BatchGetSecretValue calls the cache has in flight at once.  Further calls
+	//queue, foreground calls ahead of those marked with WithBackgroundPriority,
+	//and leave the queue when their context is done.
+	MaxConcurrentRequests int
+
+	//When positive, the calls made to refresh a cached item are detached from
+	//the caller's context and time out after this duration instead, so that a
+	//caller giving up does not abort a refresh other callers are waiting for.
+	//Either way, a refresh cancelled by its caller is not recorded as an error,
+	//nor is one whose caller's deadline passed, while one that runs out of time
+	//by this timeout, or by the SDK's own timeouts, is.
+	RefreshTimeout time.Duration
+
+	//When positive, secrets not looked up within this duration are evicted,
+	//wiping their cached values.  Idle secrets are found by a background
+	//goroutine that Close stops.
+	IdleTimeout time.Duration
+
+	//Called as secrets and their versions are added to, refreshed in and
+	//evicted from the cache, for example to audit or count evictions.
+	Lifecycle LifecycleCallbacks
+
+	//When true, the SecretString and SecretBinary of cached values are copied
+	//into buffers of their own, which are wiped when the value is evicted,
+	//replaced or the cache closed, and lookups return copies of them.  Without
+	//a hook, the SecretBinary of the API response is wiped once copied.  With a
+	//hook, only values the hook keeps as a *secretsmanager.GetSecretValueOutput
+	//are moved, and a CacheHookWiper is passed them without their secret.
+	SecureMemory bool
+
+	//When true, the buffers used by SecureMemory are also locked in memory so
+	//they are not swapped to disk, and excluded from core dumps.  Only
+	//supported on Linux; when a buffer cannot be locked, for example because
+	//of RLIMIT_MEMLOCK, a warning is logged and the buffer is used unlocked.
+	LockMemory bool
+
+	//The generator drawing from RandSource, built once by New and shared by
+	//the items of the cache.
+	random *rand.Rand
+}
+
+// validate checks the config for values the cache cannot work with.
+// Returns an InvalidConfigError describing the first problem found.
+func (c CacheConfig) validate() error {
+	if c.MaxCacheSize <= 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "max cache size must be positive",
+			},
+		}
+	}
+
+	if c.MaxVersionsPerSecret < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "max versions per secret cannot be negative",
+			},
+		}
+	}
+
+	if c.DeletedSecretPolicy < DeletedSecretServe || c.DeletedSecretPolicy > DeletedSecretFail {
+		return &InvalidConfigError{
+			baseError{
+				Message: "unknown deleted secret policy",
+			},
+		}
+	}
+
+	if c.CacheItemTTL < 0 || c.TTL < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "cannot set negative ttl on cache",
+			},
+		}
+	}
+
+	if c.RateLimit < 0 || c.RateBurst < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "rate limit and burst cannot be negative",
+			},
+		}
+	}
+
+	if c.CircuitBreakerThreshold < 0 || c.CircuitBreakerCooldown < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "circuit breaker threshold and cooldown cannot be negative",
+			},
+		}
+	}
+
+	if c.MaxConcurrentRequests < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "max concurrent requests cannot be negative",
+			},
+		}
+	}
+
+	if c.RefreshTimeout < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "refresh timeout cannot be negative",
+			},
+		}
+	}
+
+	if c.IdleTimeout < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "idle timeout cannot be negative",
+			},
+		}
+	}
+
+	if c.LockMemory && !c.SecureMemory {
+		return &InvalidConfigError{
+			baseError{
+				Message: "LockMemory requires SecureMemory",
+			},
+		}
+	}
+
+	if c.RateBurst != 0 && c.RateLimit == 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "RateBurst requires RateLimit",
+			},
+		}
+	}
+
+	if c.CircuitBreakerCooldown != 0 && c.CircuitBreakerThreshold == 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "CircuitBreakerCooldown requires CircuitBreakerThreshold",
+			},
+		}
+	}
+
+	if c.HedgeDelay < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "hedge delay cannot be negative",
+			},
+		}
+	}
+
+	if c.HedgeClient != nil && c.HedgeDelay == 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "HedgeClient requires HedgeDelay",
+			},
+		}
+	}
+
+	if c.Hook != nil && c.HookV2 != nil {
+		return &InvalidConfigError{
+			baseError{
+				Message: "Hook and HookV2 cannot both be set",
+			},
+		}
+	}
+
+	if scheduler, ok := c.Scheduler.(interface{ validate() error }); ok {
+		if err := scheduler.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.CacheItemTTL != 0 && c.TTL != 0 && time.Duration(c.CacheItemTTL) != c.TTL {
+		return &InvalidConfigError{
+			baseError{
+				Message: "CacheItemTTL and TTL are set to different values",
+			},
+		}
+	}
+
+	return nil
+}
+
+// maxVersionsPerSecret returns the configured version limit, falling back to DefaultMaxVersionsPerSecret when unset.
+func (c CacheConfig) maxVersionsPerSecret() int {
+	if c.MaxVersionsPerSecret == 0 {
+		return DefaultMaxVersionsPerSecret
+	}
+
+	return c.MaxVersionsPerSecret
+}
+
+// versionStage returns the configured version stage, or DefaultVersionStage when unset.
+func (c CacheConfig) versionStage() string {
+	if c.VersionStage == "" {
+		return DefaultVersionStage
+	}
+
+	return c.VersionStage
 }
+
+// itemTTL returns the configured ttl, falling back to DefaultCacheItemTTL when unset.
+func (c CacheConfig) itemTTL() time.Duration {
+	if c.TTL != 0 {
+		return c.TTL
+	}
+
+	if c.CacheItemTTL != 0 {
+		return time.Duration(c.CacheItemTTL)
+	}
+
+	return time.Duration(DefaultCacheItemTTL)
+}
+
+// clock returns the configured clock, or the system clock when unset.
+func (c CacheConfig) clock() Clock {
+	if c.Clock == nil {
+		return systemClock{}
+	}
+
+	return c.Clock
+}
+
+// rand returns a random number generator drawing from the configured source.
+// Configs not built by New get a new generator for each call.
+func (c CacheConfig) rand() *rand.Rand {
+	if c.random != nil {
+		return c.random
+	}
+
+	if c.RandSource == nil {
+		return globalRand
+	}
+
+	return rand.New(c.RandSource)
+}
+
+// jitter returns the configured jitter strategy, or EqualJitter when unset.
+func (c CacheConfig) jitter() JitterStrategy {
+	if c.Jitter == nil {
+		return EqualJitter{}
+	}
+
+	return c.Jitter
+}
+
+// hook returns HookV2, or Hook adapted to CacheHookV2, or nil if neither is set.
+func (c CacheConfig) hook() CacheHookV2 {
+	if c.HookV2 != nil {
+		return c.HookV2
+	}
+
+	if c.Hook != nil {
+		return AdaptCacheHook(c.Hook)
+	}
+
+	return nil
+}
+
+// logger returns the configured logger, or one that discards everything.
+func (c CacheConfig) logger() *slog.Logger {
+	if c.Logger == nil {
+		return discardLogger
+	}
+
+	return c.Logger
+}
+
+var discardLogger = slog.New(slog.DiscardHandler)
@@ -13,6 +13,12 @@
 
 package secretcache
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
 // CacheHook is an interface to hook into the local in-memory cache. This interface will allow
 // users to perform actions on the items being stored in the in-memory
 // cache. One example would be encrypting/decrypting items stored in the
@@ -24,3 +30,144 @@ type CacheHook interface {
 	// Get derives the object from the cached object.
 	Get(data interface{}) interface{}
 }
+
+// CacheHookWiper can be implemented by a CacheHook to scrub data the cache is
+// discarding, such as versions that are no longer attached to any stage or
+// that were evicted to respect MaxVersionsPerSecret. Wipe receives the value
+// previously returned by Put and is called at most once for it.
+type CacheHookWiper interface {
+	Wipe(data interface{})
+}
+
+// HookKind identifies the kind of object passed to a CacheHookV2.
+type HookKind int
+
+const (
+	// HookKindDescription is a *secretsmanager.DescribeSecretOutput describing a secret's versions.
+	HookKindDescription HookKind = iota
+
+	// HookKindValue is a *secretsmanager.GetSecretValueOutput holding a secret value.
+	HookKindValue
+)
+
+func (k HookKind) String() string {
+	switch k {
+	case HookKindDescription:
+		return "description"
+	case HookKindValue:
+		return "value"
+	default:
+		return "unknown"
+	}
+}
+
+// HookInfo identifies the object passed to a CacheHookV2.
+type HookInfo struct {
+	// The secret id the object is cached under.
+	SecretId string
+
+	// The version id of a secret value.  Empty for descriptions.
+	VersionId string
+
+	Kind HookKind
+}
+
+// CacheHookV2 hooks into the local in-memory cache like CacheHook, with the
+// context of the lookup or refresh, a description of the object, and the
+// ability to fail.  Get must return the type of object that was given to Put.
+//
+// A failed Put fails the refresh, which is retried like any other failed
+// refresh while any previously cached value keeps being served.  A failed Get
+// fails the lookup.  Errors are returned to the caller as a *HookError.
+type CacheHookV2 interface {
+	// Put prepares the object for storing in the cache.
+	Put(ctx context.Context, info HookInfo, data interface{}) (interface{}, error)
+
+	// Get derives the object from the cached object.
+	Get(ctx context.Context, info HookInfo, data interface{}) (interface{}, error)
+}
+
+// AdaptCacheHook returns a CacheHookV2 calling hook.  The adapter also
+// implements CacheHookWiper, forwarding to hook if it implements it.
+func AdaptCacheHook(hook CacheHook) CacheHookV2 {
+	return cacheHookAdapter{hook}
+}
+
+// cacheHookAdapter is the CacheHookV2 returned by AdaptCacheHook.
+type cacheHookAdapter struct {
+	hook CacheHook
+}
+
+func (a cacheHookAdapter) Put(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	return a.hook.Put(data), nil
+}
+
+func (a cacheHookAdapter) Get(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	return a.hook.Get(data), nil
+}
+
+func (a cacheHookAdapter) Wipe(data interface{}) {
+	if wiper, ok := a.hook.(CacheHookWiper); ok {
+		wiper.Wipe(data)
+	}
+}
+
+// putWithHook returns the data to cache for value, as prepared by the configured hook.
+// Returns a *HookError if the hook fails.
+func (o *cacheObject) putWithHook(ctx context.Context, info HookInfo, value interface{}) (interface{}, error) {
+	hook := o.config.hook()
+	if hook == nil {
+		return value, nil
+	}
+
+	data, err := hook.Put(ctx, info, value)
+	if err != nil {
+		return nil, o.hookFailed(info, "Put", err)
+	}
+
+	return data, nil
+}
+
+// getWithHook returns the cached data as derived by the configured hook.
+// Returns a *HookError if the hook fails.
+func (o *cacheObject) getWithHook(ctx context.Context, info HookInfo) (interface{}, error) {
+	return o.deriveWithHook(ctx, info, o.data)
+}
+
+// deriveWithHook returns the given cached data as derived by the configured hook.
+// Returns a *HookError if the hook fails, or returns nil for cached data.
+func (o *cacheObject) deriveWithHook(ctx context.Context, info HookInfo, data interface{}) (interface{}, error) {
+	hook := o.config.hook()
+	if hook == nil || data == nil {
+		return data, nil
+	}
+
+	value, err := hook.Get(ctx, info, data)
+	if err != nil {
+		return nil, o.hookFailed(info, "Get", err)
+	}
+
+	if value == nil {
+		return nil, o.hookFailed(info, "Get", errors.New("returned nil for cached data"))
+	}
+
+	return value, nil
+}
+
+// hookFailed logs a hook failure and returns it as a *HookError.
+func (o *cacheObject) hookFailed(info HookInfo, method string, err error) error {
+	o.config.logger().Warn("cache hook failed", "secretId", info.SecretId, "versionId", info.VersionId, "kind", info.Kind.String(), "method", method, "error", err)
+
+	return &HookError{
+		baseError: baseError{
+			Message: fmt.Sprintf("cache hook %s failed for %s of secret %s: %v", method, info.Kind, info.SecretId, err),
+		},
+		HookInfo: info,
+		Err:      err,
+	}
+}
+
+// unexpectedHookType returns the *HookError for a hook that returned an object of the wrong type.
+func (o *cacheObject) unexpectedHookType(info HookInfo, value interface{}, expected string) error {
+	return o.hookFailed(info, "Get", fmt.Errorf("returned %T, expected %s", value, expected))
+}
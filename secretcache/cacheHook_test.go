@@ -15,9 +15,14 @@ package secretcache_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
 )
 
 type DummyCacheHook struct {
@@ -93,3 +98,301 @@ func TestCacheHookBinary(t *testing.T) {
 		t.Fatalf("Expected DummyCacheHook's put method to be called twice - once each for cacheItem and cacheVersion")
 	}
 }
+
+type WipingCacheHook struct {
+	DummyCacheHook
+	wiped []interface{}
+}
+
+func (hook *WipingCacheHook) Wipe(data interface{}) {
+	hook.wiped = append(hook.wiped, data)
+}
+
+func TestCacheHookWipesPrunedVersions(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	previousResult := &secretsmanager.GetSecretValueOutput{
+		SecretString: getStrPtr("my previous secret string"),
+		VersionId:    getStrPtr("other-random-uuid"),
+	}
+	mockClient.MockedGetResultByVersion = map[string]*secretsmanager.GetSecretValueOutput{
+		"other-random-uuid": previousResult,
+	}
+	hook := &WipingCacheHook{}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHook(hook),
+		secretcache.WithClock(secretcachetest.NewFakeClock(time.Now())),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	_, _ = secretCache.GetSecretStringWithStage(secretId, "AWSPREVIOUS")
+
+	// The previous version loses its last stage.
+	mockClient.MockedDescribeResult = &secretsmanager.DescribeSecretOutput{
+		VersionIdsToStages: map[string][]string{
+			"very-random-uuid": {"AWSCURRENT"},
+		},
+	}
+	secretCache.RefreshNow(secretId)
+
+	if len(hook.wiped) != 1 || hook.wiped[0] != previousResult {
+		t.Fatalf("Expected only the pruned version to be wiped, got %v", hook.wiped)
+	}
+
+	if _, err := secretCache.GetSecretStringWithStage(secretId, "AWSPREVIOUS"); err == nil {
+		t.Fatalf("Expected the pruned version to no longer be served")
+	}
+}
+
+func TestMaxVersionsPerSecret(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	hook := &WipingCacheHook{}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHook(hook),
+		secretcache.WithMaxVersionsPerSecret(1),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	_, _ = secretCache.GetSecretStringWithStage(secretId, "AWSPREVIOUS")
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.GetSecretValueCallCount != 3 {
+		t.Fatalf("Expected each version switch to fetch the value again, got %d calls", mockClient.GetSecretValueCallCount)
+	}
+
+	if len(hook.wiped) != 2 {
+		t.Fatalf("Expected the evicted versions to be wiped, got %d", len(hook.wiped))
+	}
+}
+
+type contextKey string
+
+// A CacheHookV2 recording what it is given, failing on demand
+type RecordingCacheHookV2 struct {
+	puts    []secretcache.HookInfo
+	gets    []secretcache.HookInfo
+	values  []interface{}
+	putErr  error
+	getErr  error
+	getKind secretcache.HookKind
+}
+
+func (hook *RecordingCacheHookV2) Put(ctx context.Context, info secretcache.HookInfo, data interface{}) (interface{}, error) {
+	hook.puts = append(hook.puts, info)
+	hook.values = append(hook.values, ctx.Value(contextKey("request")))
+	if hook.putErr != nil {
+		return nil, hook.putErr
+	}
+
+	return data, nil
+}
+
+func (hook *RecordingCacheHookV2) Get(ctx context.Context, info secretcache.HookInfo, data interface{}) (interface{}, error) {
+	hook.gets = append(hook.gets, info)
+	if hook.getErr != nil && info.Kind == hook.getKind {
+		return nil, hook.getErr
+	}
+
+	return data, nil
+}
+
+func TestCacheHookV2ReceivesInfoAndContext(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	hook := &RecordingCacheHookV2{}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHookV2(hook),
+	)
+
+	ctx := context.WithValue(context.Background(), contextKey("request"), "request-1")
+	result, err := secretCache.GetSecretStringWithContext(ctx, secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, result)
+	}
+
+	expected := []secretcache.HookInfo{
+		{SecretId: secretId, Kind: secretcache.HookKindDescription},
+		{SecretId: secretId, VersionId: "very-random-uuid", Kind: secretcache.HookKindValue},
+	}
+
+	if len(hook.puts) != 2 || hook.puts[0] != expected[0] || hook.puts[1] != expected[1] {
+		t.Fatalf("Expected puts %v, got %v", expected, hook.puts)
+	}
+
+	if len(hook.gets) != 2 || hook.gets[0] != expected[0] || hook.gets[1] != expected[1] {
+		t.Fatalf("Expected gets %v, got %v", expected, hook.gets)
+	}
+
+	for _, value := range hook.values {
+		if value != "request-1" {
+			t.Fatalf("Expected the hook to receive the caller's context, got %v", value)
+		}
+	}
+}
+
+func TestCacheHookV2GetError(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	decryptErr := errors.New("decryption failed")
+	hook := &RecordingCacheHookV2{getErr: decryptErr, getKind: secretcache.HookKindValue}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHookV2(hook),
+	)
+
+	_, err := secretCache.GetSecretString(secretId)
+
+	var hookErr *secretcache.HookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("Expected HookError, got %v", err)
+	}
+
+	if !errors.Is(err, decryptErr) || hookErr.Kind != secretcache.HookKindValue || hookErr.VersionId != "very-random-uuid" {
+		t.Fatalf("Unexpected hook error %+v", hookErr)
+	}
+}
+
+func TestCacheHookV2PutError(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+	hook := &RecordingCacheHookV2{putErr: errors.New("encryption failed")}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHookV2(hook),
+		secretcache.WithClock(clock),
+	)
+
+	_, err := secretCache.GetSecretString(secretId)
+
+	var hookErr *secretcache.HookError
+	if !errors.As(err, &hookErr) || hookErr.Kind != secretcache.HookKindDescription {
+		t.Fatalf("Expected HookError for the description, got %v", err)
+	}
+
+	if refreshErrors := secretCache.Stats().RefreshErrors; refreshErrors != 1 {
+		t.Fatalf("Expected 1 refresh error, got %d", refreshErrors)
+	}
+
+	// The failed refresh is retried once the hook recovers.
+	hook.putErr = nil
+	clock.Advance(time.Second)
+
+	if result, err := secretCache.GetSecretString(secretId); err != nil || result != secretString {
+		t.Fatalf("Expected %s, got %s, %v", secretString, result, err)
+	}
+}
+
+type WrongTypeCacheHook struct {
+	DummyCacheHook
+}
+
+func (hook *WrongTypeCacheHook) Get(data interface{}) interface{} {
+	if _, ok := data.(*secretsmanager.GetSecretValueOutput); ok {
+		return "not a secret value"
+	}
+
+	return data
+}
+
+func TestCacheHookWrongTypeDoesNotPanic(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHook(&WrongTypeCacheHook{}),
+	)
+
+	_, err := secretCache.GetSecretString(secretId)
+
+	var hookErr *secretcache.HookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("Expected HookError, got %v", err)
+	}
+}
+
+// A CacheHook returning nil for cached secret values
+type NilCacheHook struct {
+	DummyCacheHook
+}
+
+func (hook *NilCacheHook) Get(data interface{}) interface{} {
+	if _, ok := data.(*secretsmanager.GetSecretValueOutput); ok {
+		return nil
+	}
+
+	return data
+}
+
+// A CacheHookV2 returning a nil secret value for cached secret values
+type NilCacheHookV2 struct {
+	RecordingCacheHookV2
+}
+
+func (hook *NilCacheHookV2) Get(_ context.Context, _ secretcache.HookInfo, data interface{}) (interface{}, error) {
+	if _, ok := data.(*secretsmanager.GetSecretValueOutput); ok {
+		return (*secretsmanager.GetSecretValueOutput)(nil), nil
+	}
+
+	return data, nil
+}
+
+func TestCacheHookNilDoesNotPanic(t *testing.T) {
+	hooks := map[string]func(*secretcache.Cache){
+		"CacheHook":   secretcache.WithHook(&NilCacheHook{}),
+		"CacheHookV2": secretcache.WithHookV2(&NilCacheHookV2{}),
+	}
+
+	for name, withHook := range hooks {
+		mockClient, secretId, _ := newMockedClientWithDummyResults()
+		secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient), withHook)
+
+		var hookErr *secretcache.HookError
+		if _, err := secretCache.GetSecretString(secretId); !errors.As(err, &hookErr) {
+			t.Fatalf("%s: expected HookError from GetSecretString, got %v", name, err)
+		}
+
+		if _, err := secretCache.GetSecretBinary(secretId); !errors.As(err, &hookErr) {
+			t.Fatalf("%s: expected HookError from GetSecretBinary, got %v", name, err)
+		}
+
+		err := secretCache.BorrowSecret(context.Background(), secretId, func([]byte) error { return nil })
+		if !errors.As(err, &hookErr) {
+			t.Fatalf("%s: expected HookError from BorrowSecret, got %v", name, err)
+		}
+	}
+}
+
+func TestAdaptCacheHook(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	hook := &WipingCacheHook{}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHookV2(secretcache.AdaptCacheHook(hook)),
+		secretcache.WithMaxVersionsPerSecret(1),
+	)
+
+	if result, _ := secretCache.GetSecretString(secretId); result != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, result)
+	}
+
+	_, _ = secretCache.GetSecretStringWithStage(secretId, "AWSPREVIOUS")
+
+	if hook.putCount != 3 || hook.getCount != 4 {
+		t.Fatalf("Expected the adapted hook to be called, got %d puts and %d gets", hook.putCount, hook.getCount)
+	}
+
+	if len(hook.wiped) != 1 {
+		t.Fatalf("Expected the evicted version to be wiped through the adapter, got %d", len(hook.wiped))
+	}
+}
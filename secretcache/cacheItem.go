@@ -15,12 +15,16 @@ package secretcache
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
-	"math/rand"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
 )
 
 // secretCacheItem maintains a cache of secret versions.
@@ -30,15 +34,49 @@ type secretCacheItem struct {
 	// The next scheduled refresh time for this item.  Once the item is accessed
 	// after this time, the item will be synchronously refreshed.
 	nextRefreshTime int64
+
+	// The next scheduled refresh time for each version stage looked up directly
+	// with GetSecretValue, used when CacheConfig.DirectStageLookup is set.
+	stageRefreshTimes map[string]int64
+
+	// Set when the cached secret description was built from values fetched by
+	// stage rather than by DescribeSecret, so stages missing from it may exist.
+	partial bool
+
+	// The date the secret was marked for deletion, as of the last DescribeSecret.
+	deletedDate *time.Time
+
+	// The region that served the last refresh, when the client is a FailoverClient.
+	region string
+
+	// The time of the last successful refresh, or zero if there was none.
+	lastRefreshTime int64
+
+	// The last time the item was looked up, for CacheConfig.IdleTimeout.
+	lastAccessTime atomic.Int64
+
+	// Set to the reason once the item has been removed from the cache.  The
+	// item is then evicted by whoever next holds the lock, so that removal
+	// never waits for a lookup; holders must release the lock with unlock.
+	removed atomic.Pointer[EvictionReason]
+
+	// Set once the item's description has been evicted after its removal.
+	evicted bool
 	*cacheObject
 }
 
-// newSecretCacheItem initialises a secretCacheItem using default cache size and sets next refresh time to now
-func newSecretCacheItem(config CacheConfig, client SecretsManagerAPIClient, secretId string) secretCacheItem {
+// newSecretCacheItem initialises a secretCacheItem using the configured version limit and sets next refresh time to now
+func newSecretCacheItem(config CacheConfig, client SecretsManagerAPIClient, stats *cacheStats, secretId string) secretCacheItem {
+	versions := newLRUCache(config.maxVersionsPerSecret())
+	versions.onEvict = func(_ string, data interface{}) {
+		data.(*cacheVersion).evict(EvictedCapacity)
+	}
+
 	return secretCacheItem{
-		versions:        newLRUCache(10),
-		cacheObject:     &cacheObject{config: config, client: client, secretId: secretId, refreshNeeded: true},
-		nextRefreshTime: time.Now().UnixNano(),
+		versions:          versions,
+		cacheObject:       &cacheObject{config: config, client: client, stats: stats, secretId: secretId, refreshNeeded: true},
+		nextRefreshTime:   config.clock().Now().UnixNano(),
+		stageRefreshTimes: make(map[string]int64),
 	}
 }
 
@@ -48,30 +86,52 @@ func (ci *secretCacheItem) isRefreshNeeded() bool {
 		return true
 	}
 
-	return ci.nextRefreshTime <= time.Now().UnixNano()
+	return ci.nextRefreshTime <= ci.config.clock().Now().UnixNano()
+}
+
+// checkDeleted applies the configured DeletedSecretPolicy if the secret is scheduled for deletion.
+// Returns a *SecretDeletedError if the lookup should fail.
+func (ci *secretCacheItem) checkDeleted() error {
+	if ci.deletedDate == nil {
+		return nil
+	}
+
+	ci.stats.add(statDeletedSecretLookups)
+
+	if ci.config.DeletedSecretPolicy != DeletedSecretFail {
+		return nil
+	}
+
+	return &SecretDeletedError{
+		baseError: baseError{
+			Message: fmt.Sprintf("secret %s is scheduled for deletion", ci.secretId),
+		},
+		SecretId:    ci.secretId,
+		DeletedDate: *ci.deletedDate,
+	}
 }
 
 // getVersionId gets the version id for the given version stage.
-// Returns the version id and a boolean to indicate success.
-func (ci *secretCacheItem) getVersionId(versionStage string) (string, bool) {
-	result := ci.getWithHook()
+// Returns the version id, a boolean to indicate success and an error if the hook fails.
+func (ci *secretCacheItem) getVersionId(ctx context.Context, versionStage string) (string, bool, error) {
+	result, err := ci.getWithHook(ctx)
 	if result == nil {
-		return "", false
+		return "", false, err
 	}
 
 	if result.VersionIdsToStages == nil {
-		return "", false
+		return "", false, nil
 	}
 
 	for versionId, stages := range result.VersionIdsToStages {
 		for _, stage := range stages {
 			if versionStage == stage {
-				return versionId, true
+				return versionId, true, nil
 			}
 		}
 	}
 
-	return "", false
+	return "", false, nil
 }
 
 // executeRefresh performs the actual refresh of the cached secret information.
@@ -81,67 +141,101 @@ func (ci *secretCacheItem) executeRefresh(ctx context.Context) (*secretsmanager.
 		SecretId: &ci.secretId,
 	}
 
-	result, err := ci.client.DescribeSecret(ctx, input)
+	if ci.data != nil {
+		ctx = withStaleFallback(ctx)
+	}
 
-	var maxTTL int64
-	if ci.config.CacheItemTTL == 0 {
-		maxTTL = DefaultCacheItemTTL
-	} else {
-		maxTTL = ci.config.CacheItemTTL
+	callCtx, cancel := ci.refreshContext(ctx)
+	defer cancel()
+
+	result, err := ci.client.DescribeSecret(callCtx, input)
+
+	ttl, ttlErr := ci.refreshDelay()
+	if ttlErr != nil {
+		return nil, ttlErr
 	}
 
-	var ttl int64
+	now := ci.config.clock().Now()
+	if scheduler, ok := ci.config.Scheduler.(jitteringScheduler); err == nil && ok {
+		ttl = scheduler.nextRefresh(result, now, ttl, func(delay time.Duration) time.Duration {
+			return ci.config.jitter().Jitter(delay, ci.config.rand())
+		})
+	} else if err == nil && ci.config.Scheduler != nil {
+		ttl = ci.config.Scheduler.NextRefresh(result, now, ttl)
+	}
+
+	ci.nextRefreshTime = now.Add(ttl).UnixNano()
+	return result, err
+}
+
+// refreshDelay returns the jittered delay until the next refresh of this item.
+func (ci *secretCacheItem) refreshDelay() (time.Duration, error) {
+	maxTTL := ci.config.itemTTL()
+
 	if maxTTL < 0 {
-		return nil, &InvalidConfigError{
+		return 0, &InvalidConfigError{
 			baseError{
 				Message: "cannot set negative ttl on cache",
 			},
 		}
-	} else if maxTTL < 2 {
-		ttl = maxTTL
-	} else {
-		ttl = rand.Int63n(maxTTL/2) + maxTTL/2
 	}
 
-	ci.nextRefreshTime = time.Now().Add(time.Nanosecond * time.Duration(ttl)).UnixNano()
-	return result, err
+	return ci.config.jitter().Jitter(maxTTL, ci.config.rand()), nil
 }
 
 // getVersion gets the secret cache version associated with the given stage.
-// Returns a boolean to indicate operation success.
-func (ci *secretCacheItem) getVersion(versionStage string) (*cacheVersion, bool) {
-	versionId, versionIdFound := ci.getVersionId(versionStage)
+// Returns a boolean to indicate operation success and an error if the hook fails.
+func (ci *secretCacheItem) getVersion(ctx context.Context, versionStage string) (*cacheVersion, bool, error) {
+	versionId, versionIdFound, err := ci.getVersionId(ctx, versionStage)
 	if !versionIdFound {
-		return nil, false
+		return nil, false, err
 	}
 
+	return ci.versionFor(versionId), true, nil
+}
+
+// versionFor gets the secret cache version for the given version id, adding it if it is not cached.
+func (ci *secretCacheItem) versionFor(versionId string) *cacheVersion {
 	cachedValue, cachedValueFound := ci.versions.get(versionId)
 
 	if !cachedValueFound {
-		cacheVersion := newCacheVersion(ci.config, ci.client, ci.secretId, versionId)
-		ci.versions.putIfAbsent(versionId, &cacheVersion)
+		cacheVersion := newCacheVersion(ci.config, ci.client, ci.stats, ci.secretId, versionId)
+		if ci.versions.putIfAbsent(versionId, &cacheVersion) {
+			ci.config.onInsert(cacheVersion.hookInfo())
+		}
 		cachedValue, _ = ci.versions.get(versionId)
 	}
 
 	secretCacheVersion, _ := cachedValue.(*cacheVersion)
-	return secretCacheVersion, true
+	return secretCacheVersion
 }
 
 // refresh the cached object on demand
 func (ci *secretCacheItem) refreshNow(ctx context.Context) {
+	ci.mux.Lock()
 	ci.refreshNeeded = true
-	// Generate a random number to have a sleep jitter to not get stuck in a retry loop
-	sleep := rand.Int63n((forceRefreshJitterSleep+1)-(forceRefreshJitterSleep/2)+1) + (forceRefreshJitterSleep / 2)
+	// Sleep for a jittered delay to not get stuck in a retry loop
+	sleep := ci.config.jitter().Jitter(forceRefreshJitterSleep*time.Millisecond, ci.config.rand())
 
 	if ci.err != nil {
-		exceptionSleep := ci.nextRefreshTime - time.Now().UnixNano()
+		exceptionSleep := time.Duration(ci.nextRetryTime - ci.config.clock().Now().UnixNano())
 		if exceptionSleep > sleep {
 			sleep = exceptionSleep
 		}
 	}
+	ci.unlock()
+
+	ci.config.clock().Sleep(sleep)
+
+	ci.mux.Lock()
+	defer ci.unlock()
+	ci.refreshNeeded = true
 
-	time.Sleep(time.Millisecond * time.Duration(sleep))
-	ci.refresh(ctx)
+	if ci.config.DirectStageLookup {
+		ci.refreshStages(ctx)
+	} else {
+		ci.refresh(ctx)
+	}
 }
 
 // refresh the cached object when needed.
@@ -154,37 +248,140 @@ func (ci *secretCacheItem) refresh(ctx context.Context) {
 
 	result, err := ci.executeRefresh(ctx)
 
+	if ci.isRefreshCancelled(ctx, err) {
+		ci.refreshNeeded = true
+		return
+	}
+
+	if err == nil {
+		err = ci.setWithHook(ctx, result)
+	}
+
 	if err != nil {
-		ci.errorCount++
-		ci.err = err
-		delay := exceptionRetryDelayBase * math.Pow(exceptionRetryGrowthFactor, float64(ci.errorCount))
-		delay = math.Min(delay, exceptionRetryDelayMax)
-		delayDuration := time.Millisecond * time.Duration(delay)
-		ci.nextRetryTime = time.Now().Add(delayDuration).UnixNano()
+		ci.refreshFailed(err)
 		return
 	}
 
-	ci.setWithHook(result)
+	if result.DeletedDate != nil && ci.config.DeletedSecretPolicy == DeletedSecretWarn {
+		ci.config.logger().Warn("secret is scheduled for deletion", "secretId", ci.secretId, "deletedDate", *result.DeletedDate)
+	}
+
+	ci.deletedDate = result.DeletedDate
+	ci.setRegion(ServedRegion(result.ResultMetadata))
+	ci.pruneVersions(result)
+	ci.partial = false
 	ci.err = nil
 	ci.errorCount = 0
+	ci.stats.add(statRefreshes)
+	ci.lastRefreshTime = ci.config.clock().Now().UnixNano()
+	ci.config.onRefresh(ci.hookInfo(), nil)
+}
+
+// refreshFailed records a failed refresh and schedules the next retry.
+func (ci *secretCacheItem) refreshFailed(err error) {
+	ci.stats.add(statRefreshErrors)
+	ci.errorCount++
+	ci.err = err
+	ci.config.logger().Warn("failed to refresh secret", "secretId", ci.secretId, "errorCount", ci.errorCount, "error", err)
+	delay := exceptionRetryDelayBase * math.Pow(exceptionRetryGrowthFactor, float64(ci.errorCount))
+	delay = math.Min(delay, exceptionRetryDelayMax)
+	delayDuration := time.Millisecond * time.Duration(delay)
+	if isThrottlingError(err) {
+		ci.stats.add(statThrottledRequests)
+		delayDuration = ci.throttleRetryDelay()
+	}
+	ci.nextRetryTime = ci.config.clock().Now().Add(delayDuration).UnixNano()
+	ci.config.onRefresh(ci.hookInfo(), err)
+}
+
+// setRegion records the region that served a refresh and logs when it changes.
+func (ci *secretCacheItem) setRegion(region string) {
+	if region == "" || region == ci.region {
+		return
+	}
+
+	if ci.region != "" {
+		ci.config.logger().Info("secret served from a different region", "secretId", ci.secretId, "region", region, "previousRegion", ci.region)
+	}
+
+	ci.region = region
+}
+
+// pruneVersions drops cached versions that are no longer listed in the secret's
+// version stages, so that deprecated secret material is not kept in memory.
+func (ci *secretCacheItem) pruneVersions(result *secretsmanager.DescribeSecretOutput) {
+	for _, versionId := range ci.versions.keys() {
+		if _, found := result.VersionIdsToStages[versionId]; found {
+			continue
+		}
+
+		if removed, found := ci.versions.remove(versionId); found {
+			removed.(*cacheVersion).evict(EvictedInvalidated)
+		}
+	}
 }
 
 // getSecretValue gets the cached secret value for the given version stage.
 // Returns the GetSecretValue API result and an error if operation fails.
 func (ci *secretCacheItem) getSecretValue(ctx context.Context, versionStage string) (*secretsmanager.GetSecretValueOutput, error) {
-	if versionStage == "" && ci.config.VersionStage == "" {
-		versionStage = DefaultVersionStage
-	} else if versionStage == "" && ci.config.VersionStage != "" {
-		versionStage = ci.config.VersionStage
+	ci.mux.Lock()
+	defer ci.unlock()
+
+	version, err := ci.lookupVersion(ctx, versionStage)
+	if err != nil {
+		return nil, err
 	}
 
+	return version.getSecretValue(ctx)
+}
+
+// borrowSecret calls fn with the bytes of the cached secret for the given version stage.
+// Returns the lookup error, or the error returned by fn.
+func (ci *secretCacheItem) borrowSecret(ctx context.Context, versionStage string, fn func(secret []byte) error) error {
 	ci.mux.Lock()
-	defer ci.mux.Unlock()
+	defer ci.unlock()
+
+	version, err := ci.lookupVersion(ctx, versionStage)
+	if err != nil {
+		return err
+	}
+
+	return version.borrowSecret(ctx, fn)
+}
+
+// lookupVersion refreshes the item if needed and returns the cached version for the given version stage.
+// The caller must hold the lock.
+func (ci *secretCacheItem) lookupVersion(ctx context.Context, versionStage string) (*cacheVersion, error) {
+	if versionStage == "" {
+		versionStage = ci.config.versionStage()
+	}
+
+	if ci.config.DirectStageLookup {
+		ci.refreshStage(ctx, versionStage)
+	} else {
+		ci.refresh(ctx)
+	}
+	if err := ci.checkDeleted(); err != nil {
+		return nil, err
+	}
+
+	version, ok, err := ci.getVersion(ctx, versionStage)
 
-	ci.refresh(ctx)
-	version, ok := ci.getVersion(versionStage)
+	if !ok && err == nil && ci.partial && !ci.config.DirectStageLookup {
+		ci.refreshNeeded = true
+		ci.refresh(ctx)
+		version, ok, err = ci.getVersion(ctx, versionStage)
+	}
+
+	if err != nil {
+		return nil, err
+	}
 
 	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		if ci.err != nil {
 			return nil, ci.err
 		} else {
@@ -196,30 +393,397 @@ func (ci *secretCacheItem) getSecretValue(ctx context.Context, versionStage stri
 		}
 
 	}
-	return version.getSecretValue(ctx)
+	return version, nil
 }
 
-// setWithHook sets the cache item's data using the CacheHook, if one is configured.
-func (ci *secretCacheItem) setWithHook(result *secretsmanager.DescribeSecretOutput) {
-	if ci.config.Hook != nil {
-		ci.data = ci.config.Hook.Put(result)
-	} else {
-		ci.data = result
+// evict marks the item removed from the cache for the given reason, and
+// discards its versions and description, reporting each to OnEvict.  If a
+// lookup holds the item, evict does not wait for it: the lookup discards them
+// when it releases the item, and fetches the secret again if still running.
+func (ci *secretCacheItem) evict(reason EvictionReason) {
+	ci.removed.CompareAndSwap(nil, &reason)
+	if ci.mux.TryLock() {
+		ci.unlock()
 	}
 }
 
-// getWithHook gets the cache item's data using the CacheHook, if one is configured.
-func (ci *secretCacheItem) getWithHook() *secretsmanager.DescribeSecretOutput {
-	var result interface{}
-	if ci.config.Hook != nil {
-		result = ci.config.Hook.Get(ci.data)
-	} else {
-		result = ci.data
+// unlock releases the lock, first wiping the item if it was removed.  An item
+// removed while the lock was held, too late to be wiped, is locked again and
+// wiped unless another holder now has it and will do so.
+func (ci *secretCacheItem) unlock() {
+	for {
+		wiped := ci.wipeIfRemoved()
+		ci.mux.Unlock()
+
+		if wiped || ci.removed.Load() == nil || !ci.mux.TryLock() {
+			return
+		}
 	}
+}
 
-	if result == nil {
-		return nil
+// wipeIfRemoved wipes an item removed from the cache, including what a lookup
+// fetched into it after its removal.  Versions are reported to OnEvict with the
+// item's eviction reason, and the description the first time only.  The
+// caller must hold the lock.
+// Returns whether the item was removed.
+func (ci *secretCacheItem) wipeIfRemoved() bool {
+	reason := ci.removed.Load()
+	if reason == nil {
+		return false
+	}
+
+	ci.evictVersions(*reason)
+	if ci.evicted {
+		ci.cacheObject.wipe()
 	} else {
-		return result.(*secretsmanager.DescribeSecretOutput)
+		ci.cacheObject.evict(ci.hookInfo(), *reason)
+		ci.evicted = true
+	}
+	ci.refreshNeeded = true
+	return true
+}
+
+// evictVersions evicts every cached version for the given reason.
+// The caller must hold the lock.
+func (ci *secretCacheItem) evictVersions(reason EvictionReason) {
+	for _, data := range ci.versions.removeAll() {
+		data.(*cacheVersion).evict(reason)
 	}
 }
+
+// hookInfo describes the cached secret description to the hook.
+func (ci *secretCacheItem) hookInfo() HookInfo {
+	return HookInfo{SecretId: ci.secretId, Kind: HookKindDescription}
+}
+
+// setWithHook sets the cache item's data using the configured hook, if any.
+// Returns a *HookError and keeps the previous data if the hook fails.
+func (ci *secretCacheItem) setWithHook(ctx context.Context, result *secretsmanager.DescribeSecretOutput) error {
+	data, err := ci.putWithHook(ctx, ci.hookInfo(), result)
+	if err != nil {
+		return err
+	}
+
+	ci.data = data
+	return nil
+}
+
+// getWithHook gets the cache item's data using the configured hook, if any.
+// Returns a *HookError if the hook fails or returns an object of the wrong type.
+func (ci *secretCacheItem) getWithHook(ctx context.Context) (*secretsmanager.DescribeSecretOutput, error) {
+	data, err := ci.cacheObject.getWithHook(ctx, ci.hookInfo())
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	result, ok := data.(*secretsmanager.DescribeSecretOutput)
+	if !ok || result == nil {
+		return nil, ci.unexpectedHookType(ci.hookInfo(), data, "*secretsmanager.DescribeSecretOutput")
+	}
+
+	return result, nil
+}
+
+// isStageRefreshNeeded determines if the given version stage should be looked up
+// again.  A failed lookup backs off the whole secret, like a failed DescribeSecret.
+func (ci *secretCacheItem) isStageRefreshNeeded(versionStage string) bool {
+	if ci.cacheObject.isRefreshNeeded() {
+		return true
+	}
+
+	if ci.err != nil {
+		return false
+	}
+
+	nextRefreshTime, found := ci.stageRefreshTimes[versionStage]
+	return !found || nextRefreshTime <= ci.config.clock().Now().UnixNano()
+}
+
+// refreshStages looks up every version stage seen so far, or the configured
+// stage if none has been looked up yet.
+func (ci *secretCacheItem) refreshStages(ctx context.Context) {
+	versionStages := []string{ci.config.versionStage()}
+	if len(ci.stageRefreshTimes) > 0 {
+		versionStages = versionStages[:0]
+		for versionStage := range ci.stageRefreshTimes {
+			versionStages = append(versionStages, versionStage)
+		}
+	}
+
+	for _, versionStage := range versionStages {
+		ci.refreshNeeded = true
+		ci.refreshStage(ctx, versionStage)
+	}
+}
+
+// refreshStage looks up the version currently attached to the given stage with
+// GetSecretValue, skipping DescribeSecret.  The returned value is cached under its
+// version id and the stage mapping is merged into the cached secret description.
+// Only if the response does not identify the version is DescribeSecret called,
+// to find the version the stage is attached to.
+func (ci *secretCacheItem) refreshStage(ctx context.Context, versionStage string) {
+	if !ci.isStageRefreshNeeded(versionStage) {
+		return
+	}
+
+	ci.refreshNeeded = false
+
+	ttl, err := ci.refreshDelay()
+	if err != nil {
+		ci.refreshFailed(err)
+		return
+	}
+
+	if _, cached, _ := ci.getVersionId(ctx, versionStage); cached {
+		ctx = withStaleFallback(ctx)
+	}
+
+	callCtx, cancel := ci.refreshContext(ctx)
+	defer cancel()
+
+	result, err := ci.client.GetSecretValue(callCtx, &secretsmanager.GetSecretValueInput{
+		SecretId:     &ci.secretId,
+		VersionStage: &versionStage,
+	})
+
+	if ci.isRefreshCancelled(ctx, err) {
+		ci.refreshNeeded = true
+		return
+	}
+
+	if isDeletedSecretError(err) {
+		ci.stageDeleted(ctx, versionStage, err, ttl)
+		return
+	}
+
+	if err != nil {
+		ci.refreshFailed(err)
+		return
+	}
+
+	versionStages := append([]string{versionStage}, result.VersionStages...)
+	if result.VersionId == nil {
+		var versionId string
+		if versionId, versionStages, err = ci.describeStage(ctx, versionStage); err != nil {
+			ci.refreshFailed(err)
+			return
+		}
+
+		identified := *result
+		identified.VersionId = &versionId
+		result = &identified
+	}
+
+	if err := ci.storeStages(ctx, versionStages, result, ttl); err != nil {
+		ci.refreshFailed(err)
+	}
+}
+
+// stageDeleted records that GetSecretValue failed for the given stage because the
+// secret is scheduled for deletion.  The error does not carry the deletion date,
+// so a zero date is recorded.  A cached value for the stage is kept, for
+// DeletedSecretPolicy to decide on, until the stage's next refresh.
+func (ci *secretCacheItem) stageDeleted(ctx context.Context, versionStage string, err error, ttl time.Duration) {
+	if ci.config.DeletedSecretPolicy == DeletedSecretWarn {
+		ci.config.logger().Warn("secret is scheduled for deletion", "secretId", ci.secretId)
+	}
+
+	ci.deletedDate = &time.Time{}
+	if _, cached, _ := ci.getVersionId(ctx, versionStage); !cached {
+		ci.refreshFailed(err)
+		return
+	}
+
+	ci.stageRefreshTimes[versionStage] = ci.config.clock().Now().Add(ttl).UnixNano()
+	ci.err = nil
+	ci.errorCount = 0
+}
+
+// isDeletedSecretError reports whether err is the error GetSecretValue returns
+// for a secret scheduled for deletion.
+func isDeletedSecretError(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRequestException" &&
+		strings.Contains(apiErr.ErrorMessage(), "marked for deletion")
+}
+
+// describeStage looks up the version attached to the given stage with DescribeSecret.
+// Returns the version id and its stages, or a *VersionNotFoundError if no version has the stage.
+func (ci *secretCacheItem) describeStage(ctx context.Context, versionStage string) (string, []string, error) {
+	description, err := ci.executeRefresh(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for versionId, versionStages := range description.VersionIdsToStages {
+		if slices.Contains(versionStages, versionStage) {
+			return versionId, versionStages, nil
+		}
+	}
+
+	return "", nil, &VersionNotFoundError{
+		baseError{
+			Message: fmt.Sprintf("could not find secret version for versionStage %s", versionStage),
+		},
+	}
+}
+
+// storeStages caches a secret value fetched by version stage under its version id,
+// attaches the given stages to it and schedules their next refresh.
+// Returns a *HookError, leaving the cached stages unchanged, if the hook fails.
+func (ci *secretCacheItem) storeStages(ctx context.Context, versionStages []string, result *secretsmanager.GetSecretValueOutput, ttl time.Duration) error {
+	versionId := *result.VersionId
+	description, err := ci.mergeStages(ctx, versionId, versionStages)
+	if err != nil {
+		return err
+	}
+
+	if err := ci.versionFor(versionId).set(ctx, result); err != nil {
+		return err
+	}
+
+	if err := ci.setWithHook(ctx, description); err != nil {
+		return err
+	}
+
+	ci.deletedDate = nil
+	ci.setRegion(ServedRegion(result.ResultMetadata))
+	nextRefreshTime := ci.config.clock().Now().Add(ttl).UnixNano()
+	for _, stage := range versionStages {
+		ci.stageRefreshTimes[stage] = nextRefreshTime
+	}
+
+	ci.pruneVersions(description)
+	ci.err = nil
+	ci.errorCount = 0
+	ci.stats.add(statRefreshes)
+	ci.lastRefreshTime = ci.config.clock().Now().UnixNano()
+	ci.config.onRefresh(ci.hookInfo(), nil)
+	return nil
+}
+
+// seed stores a secret value fetched in bulk.  Without DirectStageLookup the
+// cached secret description only knows the stages of the seeded versions until
+// the next DescribeSecret, so it is marked partial.
+func (ci *secretCacheItem) seed(ctx context.Context, result *secretsmanager.GetSecretValueOutput) {
+	ci.mux.Lock()
+	defer ci.unlock()
+
+	ttl, err := ci.refreshDelay()
+	if err != nil {
+		ci.refreshFailed(err)
+		return
+	}
+
+	if err := ci.storeStages(ctx, result.VersionStages, result, ttl); err != nil {
+		ci.refreshNeeded = false
+		ci.refreshFailed(err)
+		ci.nextRefreshTime = ci.nextRetryTime
+		return
+	}
+
+	ci.refreshNeeded = false
+
+	if !ci.config.DirectStageLookup {
+		ci.partial = true
+		ci.nextRefreshTime = ci.config.clock().Now().Add(ttl).UnixNano()
+	}
+}
+
+// seedError records an error returned for this secret by a bulk fetch, so that
+// lookups back off as if the secret's own refresh had failed.
+func (ci *secretCacheItem) seedError(err error) {
+	ci.mux.Lock()
+	defer ci.unlock()
+
+	ci.refreshNeeded = false
+	ci.refreshFailed(err)
+	ci.nextRefreshTime = ci.nextRetryTime
+}
+
+// isStale reports whether a lookup of the given version stage would call
+// AWS Secrets Manager.
+func (ci *secretCacheItem) isStale(ctx context.Context, versionStage string) bool {
+	if versionStage == "" {
+		versionStage = ci.config.versionStage()
+	}
+
+	ci.mux.Lock()
+	defer ci.unlock()
+
+	if ci.config.DirectStageLookup && ci.isStageRefreshNeeded(versionStage) {
+		return true
+	} else if !ci.config.DirectStageLookup && ci.isRefreshNeeded() {
+		return true
+	}
+
+	versionId, found, err := ci.getVersionId(ctx, versionStage)
+	if err != nil {
+		return true
+	}
+
+	if !found {
+		return ci.partial
+	}
+
+	cachedValue, found := ci.versions.get(versionId)
+	if !found {
+		return true
+	}
+
+	version := cachedValue.(*cacheVersion)
+	version.mux.Lock()
+	defer version.mux.Unlock()
+
+	return version.isRefreshNeeded()
+}
+
+// mergeStages builds a secret description from the cached one in which the given
+// stages are attached to versionId and detached from every other version.
+// Returns a *HookError if the hook fails to return the cached description.
+func (ci *secretCacheItem) mergeStages(ctx context.Context, versionId string, versionStages []string) (*secretsmanager.DescribeSecretOutput, error) {
+	moved := make(map[string]bool, len(versionStages))
+	for _, stage := range versionStages {
+		moved[stage] = true
+	}
+
+	cached, err := ci.getWithHook(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versionIdsToStages := make(map[string][]string)
+	if cached != nil {
+		for otherId, stages := range cached.VersionIdsToStages {
+			if otherId == versionId {
+				continue
+			}
+
+			var kept []string
+			for _, stage := range stages {
+				if !moved[stage] {
+					kept = append(kept, stage)
+				}
+			}
+
+			if len(kept) > 0 {
+				versionIdsToStages[otherId] = kept
+			}
+		}
+	}
+
+	// Keep each stage once, in the order given.
+	var stages []string
+	for _, stage := range versionStages {
+		if moved[stage] {
+			stages = append(stages, stage)
+			delete(moved, stage)
+		}
+	}
+	versionIdsToStages[versionId] = stages
+
+	return &secretsmanager.DescribeSecretOutput{
+		Name:               &ci.secretId,
+		VersionIdsToStages: versionIdsToStages,
+	}, nil
+}
@@ -14,8 +14,8 @@
 package secretcache
 
 import (
+	"context"
 	"sync"
-	"time"
 )
 
 const (
@@ -30,6 +30,7 @@ type cacheObject struct {
 	mux           sync.Mutex
 	config        CacheConfig
 	client        SecretsManagerAPIClient
+	stats         *cacheStats
 	secretId      string
 	err           error
 	errorCount    int
@@ -54,5 +55,55 @@ func (o *cacheObject) isRefreshNeeded() bool {
 		return true
 	}
 
-	return o.nextRetryTime <= time.Now().UnixNano()
+	return o.nextRetryTime <= o.config.clock().Now().UnixNano()
+}
+
+// wipe discards the cached data, letting the hook scrub it first if the hook
+// implements CacheHookWiper.
+func (o *cacheObject) wipe() {
+	if wiper, ok := o.config.hook().(CacheHookWiper); ok && o.data != nil {
+		wiper.Wipe(o.data)
+	}
+
+	o.data = nil
+}
+
+// evict wipes the cached data of an entry leaving the cache and reports it to OnEvict.
+func (o *cacheObject) evict(info HookInfo, reason EvictionReason) {
+	o.wipe()
+	o.stats.add(statEvictions)
+	o.config.onEvict(info, reason)
+}
+
+// refreshContext returns the context for a call made by a refresh.  With
+// CacheConfig.RefreshTimeout set, the call is detached from the caller's
+// cancellation and bounded by the timeout instead.
+func (o *cacheObject) refreshContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.config.RefreshTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	ctx = context.WithValue(context.WithoutCancel(ctx), refreshTimeoutKey{}, true)
+	return context.WithTimeout(ctx, o.config.RefreshTimeout)
+}
+
+// refreshTimeoutKey marks the contexts made by refreshContext, whose deadline is
+// the cache's rather than the caller's.
+type refreshTimeoutKey struct{}
+
+// isCallerCancellation reports whether err came while the caller's context was
+// done, cancelled or past its deadline, rather than from AWS Secrets Manager.
+// Such errors say nothing about the secret and are not recorded.  A deadline
+// set by CacheConfig.RefreshTimeout is not the caller's, nor is a timeout of
+// the SDK itself, and both are recorded as failures.
+func isCallerCancellation(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() != nil && ctx.Value(refreshTimeoutKey{}) == nil
+}
+
+// isRefreshCancelled reports whether a refresh of the object, made with the
+// caller's context ctx, failed with err because of the caller.  With
+// CacheConfig.RefreshTimeout set the refresh is detached from the caller, so
+// it never is.
+func (o *cacheObject) isRefreshCancelled(ctx context.Context, err error) bool {
+	return o.config.RefreshTimeout <= 0 && isCallerCancellation(ctx, err)
 }
@@ -58,6 +58,7 @@ func TestMaxCacheTTL(t *testing.T) {
 	mockClient := dummyClient{}
 
 	cacheItem := secretCacheItem{
+		versions: newLRUCache(DefaultMaxVersionsPerSecret),
 		cacheObject: &cacheObject{
 			secretId: "dummy-secret-name",
 			client:   &mockClient,
@@ -92,6 +93,7 @@ func TestRefreshNow(t *testing.T) {
 	mockClient := dummyClient{}
 
 	cacheItem := secretCacheItem{
+		versions: newLRUCache(DefaultMaxVersionsPerSecret),
 		cacheObject: &cacheObject{
 			secretId: "dummy-secret-name",
 			client:   &mockClient,
@@ -126,6 +128,65 @@ func TestRefreshNow(t *testing.T) {
 
 }
 
+func TestRefreshNowWithClock(t *testing.T) {
+	mockClient := dummyClient{}
+
+	cacheItem := secretCacheItem{
+		versions: newLRUCache(DefaultMaxVersionsPerSecret),
+		cacheObject: &cacheObject{
+			secretId: "dummy-secret-name",
+			client:   &mockClient,
+			data: &secretsmanager.DescribeSecretOutput{
+				ARN:         getStrPtr("dummy-arn"),
+				Name:        getStrPtr("dummy-name"),
+				Description: getStrPtr("dummy-description"),
+			},
+		},
+	}
+
+	config := CacheConfig{CacheItemTTL: 0, Clock: &sleepingClock{now: time.Now()}}
+	cacheItem.config = config
+	cacheItem.refresh(context.Background())
+	refreshTime := cacheItem.nextRefreshTime
+
+	cacheItem.refresh(context.Background())
+
+	if refreshTime != cacheItem.nextRefreshTime {
+		t.Fatalf("Expected nextRefreshTime to be same")
+	}
+
+	cacheItem.refreshNow(context.Background())
+
+	if cacheItem.nextRefreshTime == refreshTime {
+		t.Fatalf("Expected nextRefreshTime to be different")
+	}
+
+	if cacheItem.errorCount > 0 {
+		t.Fatalf("Expected errorCount to be 0")
+	}
+
+}
+
+// sleepingClock is a Clock whose Sleep advances time instead of blocking.
+type sleepingClock struct {
+	now time.Time
+}
+
+func (c *sleepingClock) Now() time.Time {
+	return c.now
+}
+
+func (c *sleepingClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func (c *sleepingClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
 type dummyClient struct {
 	SecretsManagerAPIClient
 }
@@ -138,3 +199,48 @@ func (d *dummyClient) DescribeSecret(context context.Context, input *secretsmana
 func getStrPtr(str string) *string {
 	return &str
 }
+
+// stageClient serves the same version for every stage.
+type stageClient struct {
+	SecretsManagerAPIClient
+}
+
+func (c *stageClient) GetSecretValue(context.Context, *secretsmanager.GetSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString:  getStrPtr("my secret string"),
+		VersionId:     getStrPtr("dummy-version"),
+		VersionStages: []string{"AWSCURRENT"},
+	}, nil
+}
+
+func TestLookupOfInvalidatedItem(t *testing.T) {
+	var evicted []HookInfo
+	secretCache, _ := New(
+		WithClient(&stageClient{}),
+		WithDirectStageLookup(true),
+		WithLifecycleCallbacks(LifecycleCallbacks{
+			OnEvict: func(info HookInfo, _ EvictionReason) { evicted = append(evicted, info) },
+		}),
+	)
+
+	// A lookup holding the item while it is invalidated fetches into it.
+	cacheItem := secretCache.getCachedSecret("dummy-secret-name")
+	secretCache.Invalidate("dummy-secret-name")
+
+	result, err := cacheItem.getSecretValue(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if *result.SecretString != "my secret string" {
+		t.Fatalf("Expected the fetched secret string, got %s", *result.SecretString)
+	}
+
+	if cacheItem.data != nil || len(cacheItem.versions.keys()) != 0 {
+		t.Fatalf("Expected the fetched data to be wiped")
+	}
+
+	if len(evicted) != 2 || evicted[1].Kind != HookKindValue {
+		t.Fatalf("Expected the fetched version to be reported as evicted, got %+v", evicted)
+	}
+}
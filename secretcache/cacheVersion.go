@@ -24,14 +24,18 @@ import (
 // cacheVersion is the cache object for a secret version.
 type cacheVersion struct {
 	versionId string
+
+	// The secret of the cached value, when CacheConfig.SecureMemory is set.
+	// The value in data then has no SecretString or SecretBinary.
+	secret *secureValue
 	*cacheObject
 }
 
 // newCacheVersion initialises a cacheVersion to cache a secret version.
-func newCacheVersion(config CacheConfig, client SecretsManagerAPIClient, secretId string, versionId string) cacheVersion {
+func newCacheVersion(config CacheConfig, client SecretsManagerAPIClient, stats *cacheStats, secretId string, versionId string) cacheVersion {
 	return cacheVersion{
 		versionId:   versionId,
-		cacheObject: &cacheObject{config: config, client: client, secretId: secretId, refreshNeeded: true},
+		cacheObject: &cacheObject{config: config, client: client, stats: stats, secretId: secretId, refreshNeeded: true},
 	}
 }
 
@@ -48,7 +52,19 @@ func (cv *cacheVersion) refresh(ctx context.Context) {
 
 	cv.refreshNeeded = false
 
-	result, err := cv.executeRefresh(ctx)
+	callCtx, cancel := cv.refreshContext(ctx)
+	defer cancel()
+
+	result, err := cv.executeRefresh(callCtx)
+
+	if cv.isRefreshCancelled(ctx, err) {
+		cv.refreshNeeded = true
+		return
+	}
+
+	if err == nil {
+		err = cv.setWithHook(ctx, result)
+	}
 
 	if err != nil {
 		cv.errorCount++
@@ -56,14 +72,18 @@ func (cv *cacheVersion) refresh(ctx context.Context) {
 		delay := exceptionRetryDelayBase * math.Pow(exceptionRetryGrowthFactor, float64(cv.errorCount))
 		delay = math.Min(delay, exceptionRetryDelayMax)
 		delayDuration := time.Nanosecond * time.Duration(delay)
-		cv.nextRetryTime = time.Now().Add(delayDuration).UnixNano()
+		if isThrottlingError(err) {
+			cv.stats.add(statThrottledRequests)
+			delayDuration = cv.throttleRetryDelay()
+		}
+		cv.nextRetryTime = cv.config.clock().Now().Add(delayDuration).UnixNano()
+		cv.config.onRefresh(cv.hookInfo(), err)
 		return
 	}
 
-	cv.setWithHook(result)
 	cv.err = nil
 	cv.errorCount = 0
-
+	cv.config.onRefresh(cv.hookInfo(), nil)
 }
 
 // executeRefresh performs the actual refresh of the cached secret information.
@@ -82,32 +102,136 @@ func (cv *cacheVersion) getSecretValue(ctx context.Context) (*secretsmanager.Get
 	cv.mux.Lock()
 	defer cv.mux.Unlock()
 
+	return cv.currentValue(ctx)
+}
+
+// borrowSecret calls fn with the bytes of the cached secret version, a view
+// of the secure buffer when there is one and a wiped copy otherwise.
+// Returns the lookup error, or the error returned by fn.
+func (cv *cacheVersion) borrowSecret(ctx context.Context, fn func(secret []byte) error) error {
+	cv.mux.Lock()
+	defer cv.mux.Unlock()
+
+	result, err := cv.currentValue(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cv.secret != nil && cv.config.hook() == nil {
+		return fn(cv.secret.view())
+	}
+
+	secret := append([]byte{}, secretBytes(result)...)
+	defer clear(secret)
+
+	return fn(secret)
+}
+
+// currentValue refreshes the cached secret version value if needed and returns it.
+// The caller must hold the lock.
+func (cv *cacheVersion) currentValue(ctx context.Context) (*secretsmanager.GetSecretValueOutput, error) {
 	cv.refresh(ctx)
 
-	return cv.getWithHook(), cv.err
+	if err := ctx.Err(); err != nil && cv.data == nil && cv.err == nil {
+		return nil, err
+	}
+
+	result, err := cv.getWithHook(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, cv.err
 }
 
-// setWithHook sets the cache item's data using the CacheHook, if one is configured.
-func (cv *cacheVersion) setWithHook(result *secretsmanager.GetSecretValueOutput) {
-	if cv.config.Hook != nil {
-		cv.data = cv.config.Hook.Put(result)
-	} else {
-		cv.data = result
+// set stores a secret version value that was fetched outside of refresh.
+// A version's value never changes, so an already cached value is kept.
+// Returns a *HookError if the hook fails to store the value.
+func (cv *cacheVersion) set(ctx context.Context, result *secretsmanager.GetSecretValueOutput) error {
+	cv.mux.Lock()
+	defer cv.mux.Unlock()
+
+	if cv.data != nil && cv.err == nil {
+		return nil
+	}
+
+	if err := cv.setWithHook(ctx, result); err != nil {
+		return err
 	}
+
+	cv.refreshNeeded = false
+	cv.err = nil
+	cv.errorCount = 0
+	cv.config.onRefresh(cv.hookInfo(), nil)
+	return nil
 }
 
-// getWithHook gets the cache item's data using the CacheHook, if one is configured.
-func (cv *cacheVersion) getWithHook() *secretsmanager.GetSecretValueOutput {
-	var result interface{}
-	if cv.config.Hook != nil {
-		result = cv.config.Hook.Get(cv.data)
-	} else {
-		result = cv.data
+// evict discards the cached secret version value and reports it to OnEvict.
+func (cv *cacheVersion) evict(reason EvictionReason) {
+	cv.mux.Lock()
+	defer cv.mux.Unlock()
+
+	cv.wipeSecret()
+	cv.cacheObject.evict(cv.hookInfo(), reason)
+}
+
+// wipeSecret wipes the secure buffer, if any.
+func (cv *cacheVersion) wipeSecret() {
+	if cv.secret != nil {
+		cv.secret.wipe()
+		cv.secret = nil
 	}
+}
 
-	if result == nil {
-		return nil
-	} else {
-		return result.(*secretsmanager.GetSecretValueOutput)
+// hookInfo describes the cached secret version to the hook.
+func (cv *cacheVersion) hookInfo() HookInfo {
+	return HookInfo{SecretId: cv.secretId, VersionId: cv.versionId, Kind: HookKindValue}
+}
+
+// setWithHook sets the cache item's data using the configured hook, if any.
+// With CacheConfig.SecureMemory set, the secret of a value the hook keeps as a
+// *secretsmanager.GetSecretValueOutput is moved to a secure buffer, and without
+// a hook, which could have kept it, the result's SecretBinary is wiped.
+// Returns a *HookError and keeps the previous data if the hook fails.
+func (cv *cacheVersion) setWithHook(ctx context.Context, result *secretsmanager.GetSecretValueOutput) error {
+	data, err := cv.putWithHook(ctx, cv.hookInfo(), result)
+	if err != nil {
+		return err
+	}
+
+	cv.wipeSecret()
+	if value, ok := data.(*secretsmanager.GetSecretValueOutput); ok && value != nil && cv.config.SecureMemory {
+		var lockErr error
+		cv.secret, data, lockErr = newSecureValue(value, cv.config.LockMemory)
+		if lockErr != nil {
+			cv.config.logger().Warn("failed to lock secret in memory", "secretId", cv.secretId, "versionId", cv.versionId, "error", lockErr)
+		}
+		if cv.config.hook() == nil {
+			clear(value.SecretBinary)
+		}
+	}
+
+	cv.data = data
+	return nil
+}
+
+// getWithHook gets the cache item's data using the configured hook, if any.
+// Returns a *HookError if the hook fails or returns an object of the wrong type.
+func (cv *cacheVersion) getWithHook(ctx context.Context) (*secretsmanager.GetSecretValueOutput, error) {
+	data := cv.data
+	if cv.secret != nil {
+		data = cv.secret.restore(data.(*secretsmanager.GetSecretValueOutput))
+	}
+
+	data, err := cv.deriveWithHook(ctx, cv.hookInfo(), data)
+	if err != nil || data == nil {
+		return nil, err
 	}
+
+	result, ok := data.(*secretsmanager.GetSecretValueOutput)
+	if !ok || result == nil {
+		return nil, cv.unexpectedHookType(cv.hookInfo(), data, "*secretsmanager.GetSecretValueOutput")
+	}
+
+	return result, nil
 }
@@ -16,12 +16,16 @@ package secretcache_test
 import (
 	"bytes"
 	"errors"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
 
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
 )
 
 func TestInstantiatesClient(t *testing.T) {
@@ -32,6 +36,35 @@ func TestInstantiatesClient(t *testing.T) {
 	}
 }
 
+func TestNewDefaultTTL(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	if secretCache.CacheItemTTL != secretcache.DefaultCacheItemTTL {
+		t.Fatalf("Expected the default CacheItemTTL, got %d", secretCache.CacheItemTTL)
+	}
+
+	secretCache, err := secretcache.New(secretcache.WithClient(&mockClient), secretcache.WithTTL(time.Minute))
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if secretCache.TTL != time.Minute || secretCache.CacheItemTTL != time.Minute.Nanoseconds() {
+		t.Fatalf("Expected WithTTL to set both TTL fields, got %v and %d", secretCache.TTL, secretCache.CacheItemTTL)
+	}
+
+	secretCache, err = secretcache.New(secretcache.WithClient(&mockClient), func(c *secretcache.Cache) { c.TTL = time.Minute })
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if secretCache.TTL != time.Minute || secretCache.CacheItemTTL != time.Minute.Nanoseconds() {
+		t.Fatalf("Expected TTL to replace the default CacheItemTTL, got %v and %d", secretCache.TTL, secretCache.CacheItemTTL)
+	}
+}
+
 func TestGetSecretString(t *testing.T) {
 	mockClient, _, secretString := newMockedClientWithDummyResults()
 	secretCache, _ := secretcache.New(
@@ -401,6 +434,50 @@ func TestRefreshNow(t *testing.T) {
 
 }
 
+// RefreshNow sleeps on the configured clock, so a fake clock must not stall it.
+func TestRefreshNowWithClock(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(
+		func(c *secretcache.Cache) { c.Client = &mockClient },
+		func(c *secretcache.Cache) { c.CacheConfig.CacheItemTTL = time.Hour.Nanoseconds() },
+		secretcache.WithClock(secretcachetest.NewFakeClock(time.Now())),
+	)
+	originalSecret, err := secretCache.GetSecretString(secretId)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+	if originalSecret != secretString {
+		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, originalSecret)
+	}
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 1 {
+		t.Fatalf("Expected a single call to DescribeSecret API, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	secretCache.RefreshNow(secretId)
+	refreshedSecret, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if refreshedSecret != secretString {
+		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, refreshedSecret)
+	}
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected two calls to DescribeSecret API, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected two calls to DescribeSecret API, got %d", mockClient.DescribeSecretCallCount)
+	}
+}
+
 func TestGetSecretVersionStageEmpty(t *testing.T) {
 	mockClient, _, secretString := newMockedClientWithDummyResults()
 
@@ -434,3 +511,575 @@ func TestGetSecretVersionStageEmpty(t *testing.T) {
 		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
 	}
 }
+
+func TestNewWithOptions(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	hook := &DummyCacheHook{}
+
+	secretCache, err := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithMaxCacheSize(5),
+		secretcache.WithTTL(time.Minute),
+		secretcache.WithVersionStage("versionStage-42"),
+		secretcache.WithHook(hook),
+	)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if secretCache.MaxCacheSize != 5 {
+		t.Fatalf("Expected MaxCacheSize to be 5, got %d", secretCache.MaxCacheSize)
+	}
+
+	if secretCache.TTL != time.Minute {
+		t.Fatalf("Expected TTL to be one minute, got %s", secretCache.TTL)
+	}
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
+	}
+
+	if hook.putCount == 0 {
+		t.Fatalf("Expected the configured hook to be used")
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+
+	testCases := map[string][]func(*secretcache.Cache){
+		"zero max cache size":      {secretcache.WithMaxCacheSize(0)},
+		"negative max cache size":  {secretcache.WithMaxCacheSize(-1)},
+		"negative ttl":             {secretcache.WithTTL(-time.Second)},
+		"negative ttl field":       {func(c *secretcache.Cache) { c.CacheItemTTL = -1 }},
+		"negative version limit":   {secretcache.WithMaxVersionsPerSecret(-1)},
+		"unknown deleted policy":   {secretcache.WithDeletedSecretPolicy(42)},
+		"negative hedge delay":     {secretcache.WithHedging(-time.Second, nil)},
+		"negative rate limit":      {secretcache.WithRateLimit(-1, 0)},
+		"negative breaker":         {secretcache.WithCircuitBreaker(-1, 0)},
+		"negative concurrency":     {secretcache.WithMaxConcurrentRequests(-1)},
+		"negative refresh timeout": {secretcache.WithRefreshTimeout(-1)},
+		"negative idle timeout":    {secretcache.WithIdleTimeout(-1)},
+		"lock without secure":      {func(c *secretcache.Cache) { c.LockMemory = true }},
+		"burst without rate":       {secretcache.WithRateLimit(0, 5)},
+		"cooldown without breaker": {secretcache.WithCircuitBreaker(0, time.Minute)},
+		"hedge client no delay":    {secretcache.WithHedging(0, &mockClient)},
+		"both hooks":               {secretcache.WithHook(&DummyCacheHook{}), secretcache.WithHookV2(&RecordingCacheHookV2{})},
+		"empty config":             {secretcache.WithCacheConfig(secretcache.CacheConfig{})},
+		"negative rotation delay":  {secretcache.WithScheduler(secretcache.RotationAwareScheduler{PostRotationDelay: -time.Minute})},
+		"negative ttl multiplier":  {secretcache.WithScheduler(&secretcache.RotationAwareScheduler{StaticTTLMultiplier: -1})},
+		"conflicting ttls": {
+			secretcache.WithTTL(time.Minute),
+			func(c *secretcache.Cache) { c.CacheItemTTL = (2 * time.Hour).Nanoseconds() },
+		},
+	}
+
+	for name, optFns := range testCases {
+		secretCache, err := secretcache.New(append(optFns, secretcache.WithClient(&mockClient))...)
+
+		var configErr *secretcache.InvalidConfigError
+		if !errors.As(err, &configErr) {
+			t.Fatalf("%s: expected InvalidConfigError, got %v", name, err)
+		}
+
+		if secretCache != nil {
+			t.Fatalf("%s: expected no cache to be returned", name)
+		}
+	}
+}
+
+func TestGetSecretStringTTLExpiry(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithTTL(time.Hour),
+		secretcache.WithClock(clock),
+	)
+
+	_, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	// The refresh time is jittered into the second half of the ttl.
+	clock.Advance(29 * time.Minute)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 1 {
+		t.Fatalf("Expected a single call to DescribeSecret API before the ttl, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	clock.Advance(31 * time.Minute)
+	_, err = secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected two calls to DescribeSecret API after the ttl, got %d", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestGetSecretStringErrorBackoff(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = errors.New("serviceUnavailable")
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+	)
+
+	for i := 0; i < 10; i++ {
+		if _, err := secretCache.GetSecretString(secretId); err == nil {
+			t.Fatalf("Expected error while DescribeSecret is failing")
+		}
+	}
+
+	if mockClient.DescribeSecretCallCount != 1 {
+		t.Fatalf("Expected a single call to DescribeSecret API during backoff, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	clock.Advance(time.Second)
+	mockClient.DescribeSecretErr = nil
+
+	if _, err := secretCache.GetSecretString(secretId); err != nil {
+		t.Fatalf("Unexpected error after backoff - %s", err.Error())
+	}
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected a retry once the backoff elapsed, got %d", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestGetSecretUsesConfiguredVersionStage(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	previousString := "my previous secret string"
+	mockClient.MockedGetResultByVersion = map[string]*secretsmanager.GetSecretValueOutput{
+		"other-random-uuid": {
+			Name:          getStrPtr(secretId),
+			SecretString:  &previousString,
+			VersionId:     getStrPtr("other-random-uuid"),
+			VersionStages: []string{"AWSPREVIOUS"},
+		},
+	}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithVersionStage("AWSPREVIOUS"),
+	)
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != previousString {
+		t.Fatalf("Expected the configured version stage to be used - \"%s\", \"%s\"", previousString, result)
+	}
+
+	result, err = secretCache.GetSecretStringWithStage(secretId, "")
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != previousString {
+		t.Fatalf("Expected an empty stage to select the configured version stage - \"%s\", \"%s\"", previousString, result)
+	}
+
+	result, err = secretCache.GetSecretStringWithStage(secretId, "AWSCURRENT")
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected an explicit stage to override the configured one - \"%s\", \"%s\"", secretString, result)
+	}
+}
+
+func TestGetSecretBinaryUsesConfiguredVersionStage(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	currentBinary := []byte{0, 1, 0, 1}
+	previousBinary := []byte{1, 0, 1, 0}
+	mockClient.MockedGetResult.SecretString = nil
+	mockClient.MockedGetResult.SecretBinary = currentBinary
+	mockClient.MockedGetResultByVersion = map[string]*secretsmanager.GetSecretValueOutput{
+		"other-random-uuid": {
+			Name:          getStrPtr(secretId),
+			SecretBinary:  previousBinary,
+			VersionId:     getStrPtr("other-random-uuid"),
+			VersionStages: []string{"AWSPREVIOUS"},
+		},
+	}
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithVersionStage("AWSPREVIOUS"),
+	)
+
+	result, err := secretCache.GetSecretBinary(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if !bytes.Equal(result, previousBinary) {
+		t.Fatalf("Expected the configured version stage to be used")
+	}
+
+	result, err = secretCache.GetSecretBinaryWithStage(secretId, "AWSCURRENT")
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if !bytes.Equal(result, currentBinary) {
+		t.Fatalf("Expected an explicit stage to override the configured one")
+	}
+}
+
+func TestDirectStageLookup(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithTTL(time.Hour),
+		secretcache.WithClock(clock),
+	)
+
+	for i := 0; i < 10; i++ {
+		result, err := secretCache.GetSecretString(secretId)
+
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+
+		if result != secretString {
+			t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
+		}
+	}
+
+	if mockClient.DescribeSecretCallCount != 0 {
+		t.Fatalf("Expected no calls to DescribeSecret API, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	if mockClient.GetSecretValueCallCount != 1 {
+		t.Fatalf("Expected a single call to GetSecretValue API, got %d", mockClient.GetSecretValueCallCount)
+	}
+
+	input := mockClient.GetSecretValueInputs[0]
+	if input.VersionId != nil || input.VersionStage == nil || *input.VersionStage != "AWSCURRENT" {
+		t.Fatalf("Expected GetSecretValue to be called by version stage")
+	}
+
+	// The response lists every stage of the version, so they are all known now.
+	if _, err := secretCache.GetSecretStringWithStage(secretId, "versionStage-42"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if mockClient.GetSecretValueCallCount != 1 {
+		t.Fatalf("Expected stages of a fetched version to be served from cache, got %d calls", mockClient.GetSecretValueCallCount)
+	}
+
+	clock.Advance(time.Hour)
+
+	if _, err := secretCache.GetSecretString(secretId); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if mockClient.GetSecretValueCallCount != 2 || mockClient.DescribeSecretCallCount != 0 {
+		t.Fatalf("Expected the expired stage to be looked up again without DescribeSecret")
+	}
+}
+
+func TestDirectStageLookupRotation(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithClock(clock),
+	)
+
+	if _, err := secretCache.GetSecretString(secretId); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	rotatedString := "my rotated secret string"
+	previousResult := *mockClient.MockedGetResult
+	previousResult.VersionStages = []string{"hello", "versionStage-42"}
+	mockClient.MockedGetResultByVersion = map[string]*secretsmanager.GetSecretValueOutput{
+		"versionStage-42": &previousResult,
+	}
+	mockClient.MockedGetResult = &secretsmanager.GetSecretValueOutput{
+		Name:          getStrPtr(secretId),
+		SecretString:  &rotatedString,
+		VersionId:     getStrPtr("rotated-random-uuid"),
+		VersionStages: []string{"AWSCURRENT"},
+	}
+	clock.Advance(time.Duration(secretcache.DefaultCacheItemTTL))
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != rotatedString {
+		t.Fatalf("Expected the rotated version after the ttl - \"%s\", \"%s\"", rotatedString, result)
+	}
+
+	// The old version keeps its other stages.
+	result, err = secretCache.GetSecretStringWithStage(secretId, "versionStage-42")
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected the old version for its remaining stage - \"%s\", \"%s\"", secretString, result)
+	}
+
+	result, _ = secretCache.GetSecretString(secretId)
+
+	if result != rotatedString {
+		t.Fatalf("Expected the rotated version to keep its stage - \"%s\", \"%s\"", rotatedString, result)
+	}
+}
+
+func TestDirectStageLookupFallsBackToDescribe(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	mockClient.MockedGetResult.VersionId = nil
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithDirectStageLookup(true),
+	)
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
+	}
+
+	if mockClient.DescribeSecretCallCount != 1 || mockClient.GetSecretValueCallCount != 1 {
+		t.Fatalf("Expected one GetSecretValue and one DescribeSecret call, got %d and %d", mockClient.GetSecretValueCallCount, mockClient.DescribeSecretCallCount)
+	}
+
+	// The other stages of the described version are served from the cache.
+	if result, err := secretCache.GetSecretStringWithStage(secretId, "versionStage-42"); err != nil || result != secretString {
+		t.Fatalf("Expected the cached secret string, got \"%s\", %v", result, err)
+	}
+
+	if mockClient.GetSecretValueCallCount != 1 {
+		t.Fatalf("Expected the other stages to be served from the cache, got %d calls", mockClient.GetSecretValueCallCount)
+	}
+}
+
+func TestDirectStageLookupUnknownStage(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.MockedGetResult.VersionId = nil
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithDirectStageLookup(true),
+	)
+
+	_, err := secretCache.GetSecretStringWithStage(secretId, "AWSPENDING")
+
+	var versionErr *secretcache.VersionNotFoundError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("Expected a VersionNotFoundError, got %v", err)
+	}
+}
+
+func TestDeletedSecretServe(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	deletedDate := time.Now()
+	mockClient.MockedDescribeResult.DeletedDate = &deletedDate
+
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
+	}
+
+	if stats := secretCache.Stats(); stats.DeletedSecretLookups != 1 {
+		t.Fatalf("Expected the lookup of a deleted secret to be counted, got %d", stats.DeletedSecretLookups)
+	}
+}
+
+func TestDeletedSecretWarn(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	deletedDate := time.Now()
+	mockClient.MockedDescribeResult.DeletedDate = &deletedDate
+	var logs bytes.Buffer
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithDeletedSecretPolicy(secretcache.DeletedSecretWarn),
+		secretcache.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	for i := 0; i < 3; i++ {
+		result, err := secretCache.GetSecretString(secretId)
+
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+
+		if result != secretString {
+			t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
+		}
+	}
+
+	if strings.Count(logs.String(), "secret is scheduled for deletion") != 1 {
+		t.Fatalf("Expected a single warning per refresh, got %q", logs.String())
+	}
+
+	if stats := secretCache.Stats(); stats.DeletedSecretLookups != 3 {
+		t.Fatalf("Expected each lookup of a deleted secret to be counted, got %d", stats.DeletedSecretLookups)
+	}
+}
+
+func TestDeletedSecretFailAndRestore(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	deletedDate := time.Now()
+	mockClient.MockedDescribeResult.DeletedDate = &deletedDate
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithDeletedSecretPolicy(secretcache.DeletedSecretFail),
+	)
+
+	_, err := secretCache.GetSecretString(secretId)
+
+	var deletedErr *secretcache.SecretDeletedError
+	if !errors.As(err, &deletedErr) || !errors.Is(err, secretcache.ErrSecretDeleted) {
+		t.Fatalf("Expected a SecretDeletedError, got %v", err)
+	}
+
+	if deletedErr.SecretId != secretId || !deletedErr.DeletedDate.Equal(deletedDate) {
+		t.Fatalf("Expected the error to describe the deleted secret, got %+v", deletedErr)
+	}
+
+	if _, err := secretCache.GetSecretBinary(secretId); !errors.Is(err, secretcache.ErrSecretDeleted) {
+		t.Fatalf("Expected binary lookups to fail too, got %v", err)
+	}
+
+	// RestoreSecret clears the deletion date.
+	mockClient.MockedDescribeResult.DeletedDate = nil
+	clock.Advance(time.Duration(secretcache.DefaultCacheItemTTL))
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error for a restored secret - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
+	}
+}
+
+func TestDeletedSecretDirectStageLookup(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithDeletedSecretPolicy(secretcache.DeletedSecretFail),
+	)
+
+	if _, err := secretCache.GetSecretString(secretId); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	// GetSecretValue fails for a secret scheduled for deletion.
+	mockClient.GetSecretValueErr = &smithy.GenericAPIError{
+		Code:    "InvalidRequestException",
+		Message: "You can't perform this operation on the secret because it was marked for deletion.",
+	}
+	clock.Advance(time.Duration(secretcache.DefaultCacheItemTTL))
+
+	if _, err := secretCache.GetSecretString(secretId); !errors.Is(err, secretcache.ErrSecretDeleted) {
+		t.Fatalf("Expected a SecretDeletedError, got %v", err)
+	}
+
+	if mockClient.DescribeSecretCallCount != 0 {
+		t.Fatalf("Expected deletion to be detected without DescribeSecret, got %d calls", mockClient.DescribeSecretCallCount)
+	}
+
+	// RestoreSecret makes GetSecretValue succeed again.
+	mockClient.GetSecretValueErr = nil
+	clock.Advance(time.Duration(secretcache.DefaultCacheItemTTL))
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error for a restored secret - %s", err.Error())
+	}
+
+	if result != secretString {
+		t.Fatalf("Expected and result secret string are different - \"%s\", \"%s\"", secretString, result)
+	}
+}
+
+func TestDeletedSecretDirectStageLookupServe(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	mockClient.GetSecretValueErr = &smithy.GenericAPIError{
+		Code:    "InvalidRequestException",
+		Message: "You can't perform this operation on the secret because it was marked for deletion.",
+	}
+	clock.Advance(time.Duration(secretcache.DefaultCacheItemTTL))
+
+	result, err := secretCache.GetSecretString(secretId)
+
+	if err != nil || result != secretString {
+		t.Fatalf("Expected the cached value to be served, got \"%s\", %v", result, err)
+	}
+
+	if stats := secretCache.Stats(); stats.DeletedSecretLookups != 1 || stats.RefreshErrors != 0 {
+		t.Fatalf("Expected one deleted lookup and no refresh errors, got %+v", stats)
+	}
+}
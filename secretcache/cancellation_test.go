@@ -0,0 +1,190 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+)
+
+func TestCancelledCallerDoesNotPoisonCache(t *testing.T) {
+	client := newBlockingClient()
+	secretId, secretString := "dummy-secret-name", "my secret string"
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelledErr := make(chan error)
+	go func() {
+		_, err := secretCache.GetSecretStringWithContext(ctx, secretId)
+		cancelledErr <- err
+	}()
+	waitFor(t, func() bool { return client.calls.Load() == 1 })
+
+	// Live callers queue behind the cancelled one on the same secret.
+	var wg sync.WaitGroup
+	values := make([]string, 3)
+	for i := range values {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], _ = secretCache.GetSecretString(secretId)
+		}()
+	}
+
+	cancel()
+
+	if err := <-cancelledErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancelled caller to get context.Canceled, got %v", err)
+	}
+
+	// The live callers refresh straight away instead of backing off.
+	waitFor(t, func() bool { return client.calls.Load() == 2 })
+	close(client.release)
+	wg.Wait()
+
+	for _, value := range values {
+		if value != secretString {
+			t.Fatalf("Expected %s, got %s", secretString, value)
+		}
+	}
+
+	if refreshErrors := secretCache.Stats().RefreshErrors; refreshErrors != 0 {
+		t.Fatalf("Expected no refresh errors, got %d", refreshErrors)
+	}
+}
+
+func TestCancelledCallerDescribeSecret(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Behave like a client honouring the cancelled context.
+	mockClient.DescribeSecretErr = context.Canceled
+	if _, err := secretCache.GetSecretStringWithContext(ctx, secretId); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	mockClient.DescribeSecretErr = nil
+	value, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected 2 describe calls, got %d", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestDetachedRefreshSurvivesCancellation(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithRefreshTimeout(time.Minute),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := secretCache.GetSecretStringWithContext(ctx, "dummy-secret-name")
+		done <- err
+	}()
+	waitFor(t, func() bool { return client.calls.Load() == 1 })
+
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	if cancelled := client.cancelled.Load(); cancelled != 0 {
+		t.Fatalf("Expected the refresh to carry on, got %d cancelled calls", cancelled)
+	}
+
+	close(client.release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if client.calls.Load() != 1 {
+		t.Fatalf("Expected 1 call, got %d", client.calls.Load())
+	}
+}
+
+func TestDetachedRefreshTimeout(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithRefreshTimeout(10*time.Millisecond),
+	)
+
+	_, err := secretCache.GetSecretString("dummy-secret-name")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the refresh to time out, got %v", err)
+	}
+
+	if refreshErrors := secretCache.Stats().RefreshErrors; refreshErrors != 1 {
+		t.Fatalf("Expected 1 refresh error, got %d", refreshErrors)
+	}
+}
+
+func TestCallerDeadlineNotRecorded(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	if _, err := secretCache.GetSecretStringWithContext(ctx, "dummy-secret-name"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded, got %v", err)
+	}
+
+	if refreshErrors := secretCache.Stats().RefreshErrors; refreshErrors != 0 {
+		t.Fatalf("Expected no refresh errors, got %d", refreshErrors)
+	}
+
+	for entry := range secretCache.Entries() {
+		if entry.LastError != nil || entry.ErrorCount != 0 || !entry.BackoffUntil.IsZero() {
+			t.Fatalf("Expected the caller's deadline not to back off the secret, got %+v", entry)
+		}
+	}
+
+	// The next caller refreshes straight away.
+	close(client.release)
+	if _, err := secretCache.GetSecretString("dummy-secret-name"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if calls := client.calls.Load(); calls != 2 {
+		t.Fatalf("Expected a second call, got %d", calls)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// The time an open circuit breaker waits before letting a trial call through, by default.
+const DefaultCircuitBreakerCooldown = 30 * time.Second
+
+// CircuitState is the state of the cache's circuit breaker.
+type CircuitState int32
+
+const (
+	// CircuitClosed lets every call through.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen fails every call with a *CircuitOpenError.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a single trial call through, which closes the
+	// circuit if it succeeds and opens it again if it fails.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops calls to AWS Secrets Manager after consecutive failures
+// and lets a trial call through once the cooldown has passed.
+type circuitBreaker struct {
+	mux       sync.Mutex
+	config    CacheConfig
+	stats     *cacheStats
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+
+	// Counts state changes, so that calls let through before one are ignored.
+	generation uint64
+}
+
+// circuitToken identifies a call let through by allow, to be passed to record.
+type circuitToken struct {
+	generation uint64
+	probe      bool
+}
+
+// newCircuitBreaker returns a closed circuit breaker with the settings of config.
+func newCircuitBreaker(config CacheConfig, stats *cacheStats) *circuitBreaker {
+	cooldown := config.CircuitBreakerCooldown
+	if cooldown == 0 {
+		cooldown = DefaultCircuitBreakerCooldown
+	}
+
+	return &circuitBreaker{
+		config:    config,
+		stats:     stats,
+		threshold: config.CircuitBreakerThreshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a call may be made, moving an open circuit to
+// half-open once the cooldown has passed.
+// Returns the token to record the call's outcome with, or a *CircuitOpenError
+// if the call is rejected.
+func (b *circuitBreaker) allow() (circuitToken, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.state == CircuitOpen && !b.config.clock().Now().Before(b.openedAt.Add(b.cooldown)) {
+		b.setState(CircuitHalfOpen)
+	}
+
+	switch {
+	case b.state == CircuitClosed:
+		return circuitToken{generation: b.generation}, nil
+	case b.state == CircuitHalfOpen && !b.probing:
+		b.probing = true
+		return circuitToken{generation: b.generation, probe: true}, nil
+	}
+
+	b.stats.add(statCircuitBreakerRejections)
+
+	return circuitToken{}, &CircuitOpenError{
+		baseError{
+			Message: "circuit breaker is open, not calling AWS Secrets Manager",
+		},
+	}
+}
+
+// record updates the breaker with the outcome of the call allow gave token
+// for.  Calls let through before the breaker last changed state are ignored,
+// so only the trial call decides a half-open circuit.  Calls that got no
+// answer from AWS Secrets Manager, because the caller cancelled them or its
+// deadline passed, or because the cache's rate limit rejected them, are not
+// counted.  Calls that ran out of time otherwise count as failures.
+func (b *circuitBreaker) record(token circuitToken, ctx context.Context, err error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if token.generation != b.generation {
+		return
+	}
+
+	if token.probe {
+		b.probing = false
+	}
+
+	var rateErr *RateLimitExceededError
+	if err != nil && (isCallerCancellation(ctx, err) || errors.As(err, &rateErr)) {
+		return
+	}
+
+	if err == nil || !isServiceFailure(err) {
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if token.probe || b.failures >= b.threshold {
+		b.openedAt = b.config.clock().Now()
+		if b.state != CircuitOpen {
+			b.stats.add(statCircuitBreakerTrips)
+			b.setState(CircuitOpen)
+		}
+	}
+}
+
+// setState moves the breaker to state and reports the transition.  Must be called with the lock held.
+func (b *circuitBreaker) setState(state CircuitState) {
+	b.config.logger().Warn("circuit breaker state changed", "from", b.state.String(), "to", state.String(), "failures", b.failures)
+	b.state = state
+	b.probing = false
+	b.generation++
+	b.stats.setCircuitState(state)
+}
+
+// circuitBreakerClient makes GetSecretValue, DescribeSecret and BatchGetSecretValue calls go
+// through a circuit breaker.  Other calls go to the wrapped client unchanged.
+type circuitBreakerClient struct {
+	SecretsManagerAPIClient
+	breaker *circuitBreaker
+}
+
+func (c *circuitBreakerClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	token, err := c.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := c.SecretsManagerAPIClient.GetSecretValue(ctx, params, optFns...)
+	c.breaker.record(token, ctx, err)
+	return output, err
+}
+
+func (c *circuitBreakerClient) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	token, err := c.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := c.SecretsManagerAPIClient.DescribeSecret(ctx, params, optFns...)
+	c.breaker.record(token, ctx, err)
+	return output, err
+}
+
+func (c *circuitBreakerClient) BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	token, err := c.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := callBatchGetSecretValue(ctx, c.SecretsManagerAPIClient, params, optFns...)
+	c.breaker.record(token, ctx, err)
+	return output, err
+}
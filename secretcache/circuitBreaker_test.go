@@ -0,0 +1,314 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+func newCircuitBreakerCache(mockClient *mockSecretsManagerClient, clock *secretcachetest.FakeClock, optFns ...func(*secretcache.Cache)) *secretcache.Cache {
+	secretCache, _ := secretcache.New(append([]func(*secretcache.Cache){
+		secretcache.WithClient(mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithTTL(time.Minute),
+		secretcache.WithCircuitBreaker(3, 30*time.Second),
+	}, optFns...)...)
+
+	return secretCache
+}
+
+// tripCircuit fails lookups of new secrets until the circuit breaker opens.
+func tripCircuit(secretCache *secretcache.Cache) {
+	for i := 0; i < 3; i++ {
+		_, _ = secretCache.GetSecretString("failing-" + strconv.Itoa(i))
+	}
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	var logs bytes.Buffer
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache := newCircuitBreakerCache(&mockClient, clock, secretcache.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+	tripCircuit(secretCache)
+
+	_, err := secretCache.GetSecretString(secretId)
+
+	var circuitErr *secretcache.CircuitOpenError
+	if !errors.As(err, &circuitErr) {
+		t.Fatalf("Expected CircuitOpenError, got %v", err)
+	}
+
+	if mockClient.DescribeSecretCallCount != 3 {
+		t.Fatalf("Expected 3 describe calls, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	stats := secretCache.Stats()
+	if stats.CircuitState != secretcache.CircuitOpen || stats.CircuitBreakerTrips != 1 || stats.CircuitBreakerRejections != 1 {
+		t.Fatalf("Unexpected circuit breaker stats %+v", stats)
+	}
+
+	if !strings.Contains(logs.String(), "from=closed to=open") {
+		t.Fatalf("Expected the transition to be logged, got %q", logs.String())
+	}
+}
+
+func TestCircuitBreakerServesCachedValues(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache := newCircuitBreakerCache(&mockClient, clock, secretcache.WithCircuitBreaker(3, time.Hour))
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	mockClient.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	tripCircuit(secretCache)
+	clock.Advance(time.Minute)
+
+	value, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	if mockClient.DescribeSecretCallCount != 4 {
+		t.Fatalf("Expected 4 describe calls, got %d", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache := newCircuitBreakerCache(&mockClient, clock)
+
+	tripCircuit(secretCache)
+
+	// A failed trial call opens the circuit again.
+	clock.Advance(30 * time.Second)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 4 {
+		t.Fatalf("Expected 4 describe calls, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	if state := secretCache.Stats().CircuitState; state != secretcache.CircuitOpen {
+		t.Fatalf("Expected the circuit to be open, got %s", state)
+	}
+
+	// A successful trial call closes it.
+	mockClient.DescribeSecretErr = nil
+	clock.Advance(30 * time.Second)
+
+	value, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	if state := secretCache.Stats().CircuitState; state != secretcache.CircuitClosed {
+		t.Fatalf("Expected the circuit to be closed, got %s", state)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = newServerError(http.StatusBadRequest)
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache := newCircuitBreakerCache(&mockClient, clock)
+
+	tripCircuit(secretCache)
+	_, err := secretCache.GetSecretString(secretId)
+
+	if err != mockClient.DescribeSecretErr {
+		t.Fatalf("Expected the client error, got %v", err)
+	}
+
+	if state := secretCache.Stats().CircuitState; state != secretcache.CircuitClosed {
+		t.Fatalf("Expected the circuit to be closed, got %s", state)
+	}
+}
+
+func TestCircuitBreakerOpensOnTimeouts(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithCircuitBreaker(2, time.Hour),
+		secretcache.WithRefreshTimeout(5*time.Millisecond),
+	)
+
+	// Timed out by the refresh timeout.
+	_, _ = secretCache.GetSecretString("failing-0")
+	_, _ = secretCache.GetSecretString("failing-1")
+
+	stats := secretCache.Stats()
+	if stats.CircuitState != secretcache.CircuitOpen || stats.CircuitBreakerTrips != 1 {
+		t.Fatalf("Expected the timeouts to open the circuit, got %+v", stats)
+	}
+
+	var circuitErr *secretcache.CircuitOpenError
+	if _, err := secretCache.GetSecretString("failing-2"); !errors.As(err, &circuitErr) {
+		t.Fatalf("Expected CircuitOpenError, got %v", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresCancelledCalls(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithCircuitBreaker(1, time.Hour),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := secretCache.GetSecretStringWithContext(ctx, "cancelled")
+		done <- err
+	}()
+	waitFor(t, func() bool { return client.calls.Load() == 1 })
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if state := secretCache.Stats().CircuitState; state != secretcache.CircuitClosed {
+		t.Fatalf("Expected the circuit to be closed, got %s", state)
+	}
+}
+
+func TestCircuitBreakerIgnoresCallerDeadlines(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithCircuitBreaker(1, time.Hour),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	if _, err := secretCache.GetSecretStringWithContext(ctx, "deadline"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	stats := secretCache.Stats()
+	if stats.CircuitState != secretcache.CircuitClosed || stats.CircuitBreakerTrips != 0 {
+		t.Fatalf("Expected the circuit to stay closed, got %+v", stats)
+	}
+}
+
+// perSecretClient answers GetSecretValue with the error set for the secret, after
+// waiting for the secret's gate if it has one.
+type perSecretClient struct {
+	mockSecretsManagerClient
+	gates map[string]chan struct{}
+	errs  map[string]error
+	calls atomic.Int32
+}
+
+func (m *perSecretClient) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.calls.Add(1)
+
+	if gate, ok := m.gates[*input.SecretId]; ok {
+		<-gate
+	}
+
+	if err := m.errs[*input.SecretId]; err != nil {
+		return nil, err
+	}
+
+	return m.MockedGetResult, nil
+}
+
+func TestCircuitBreakerIgnoresStaleCalls(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	client := &perSecretClient{
+		mockSecretsManagerClient: mockClient,
+		gates:                    map[string]chan struct{}{"stale": make(chan struct{}), "probe": make(chan struct{})},
+		errs: map[string]error{
+			"failing": newServerError(http.StatusServiceUnavailable),
+			"probe":   newServerError(http.StatusServiceUnavailable),
+		},
+	}
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithCircuitBreaker(1, 30*time.Second),
+	)
+
+	lookup := func(secretId string) chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := secretCache.GetSecretString(secretId)
+			done <- err
+		}()
+		return done
+	}
+
+	// A call made while the circuit was closed is still in flight when a
+	// failure opens it and the cooldown lets a trial call through.
+	stale := lookup("stale")
+	waitFor(t, func() bool { return client.calls.Load() == 1 })
+	_, _ = secretCache.GetSecretString("failing")
+	clock.Advance(30 * time.Second)
+	probe := lookup("probe")
+	waitFor(t, func() bool { return client.calls.Load() == 3 })
+
+	close(client.gates["stale"])
+	if err := <-stale; err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if state := secretCache.Stats().CircuitState; state != secretcache.CircuitHalfOpen {
+		t.Fatalf("Expected the stale call to leave the circuit half-open, got %s", state)
+	}
+
+	var circuitErr *secretcache.CircuitOpenError
+	if _, err := secretCache.GetSecretString("other"); !errors.As(err, &circuitErr) {
+		t.Fatalf("Expected a second trial call to be rejected, got %v", err)
+	}
+
+	close(client.gates["probe"])
+	<-probe
+
+	if state := secretCache.Stats().CircuitState; state != secretcache.CircuitOpen {
+		t.Fatalf("Expected the failed trial call to open the circuit, got %s", state)
+	}
+}
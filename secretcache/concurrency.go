@@ -0,0 +1,145 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// backgroundKey marks the context of a call made in the background.
+type backgroundKey struct{}
+
+// WithBackgroundPriority marks ctx as belonging to background work, such as
+// warming the cache.  When CacheConfig.MaxConcurrentRequests is set, calls made
+// with it wait until no foreground call is queued.
+func WithBackgroundPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+func isBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
+
+// concurrencyLimiter caps the number of calls in flight.  Callers over the cap
+// queue in arrival order, foreground callers ahead of background ones.
+type concurrencyLimiter struct {
+	mux        sync.Mutex
+	capacity   int
+	inFlight   int
+	foreground list.List
+	background list.List
+}
+
+// waiter is a caller queued for a slot.  ready is closed once it is granted one.
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// acquire takes a slot, queueing until one is free.
+// Returns the context's error if it is done first, in which case no slot is taken.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	l.mux.Lock()
+
+	if l.inFlight < l.capacity && l.foreground.Len() == 0 && l.background.Len() == 0 {
+		l.inFlight++
+		l.mux.Unlock()
+		return nil
+	}
+
+	queue := &l.foreground
+	if isBackground(ctx) {
+		queue = &l.background
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	element := queue.PushBack(w)
+	l.mux.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mux.Lock()
+	granted := w.granted
+	if !granted {
+		queue.Remove(element)
+	}
+	l.mux.Unlock()
+
+	// The slot was handed over as the context expired; pass it on.
+	if granted {
+		l.release()
+	}
+
+	return ctx.Err()
+}
+
+// release frees a slot, handing it to the next queued caller if there is one.
+func (l *concurrencyLimiter) release() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	for _, queue := range []*list.List{&l.foreground, &l.background} {
+		if front := queue.Front(); front != nil {
+			w := queue.Remove(front).(*waiter)
+			w.granted = true
+			close(w.ready)
+			return
+		}
+	}
+
+	l.inFlight--
+}
+
+// concurrencyLimitedClient makes GetSecretValue, DescribeSecret and BatchGetSecretValue
+// calls hold a slot of a shared concurrencyLimiter.  Other calls go to the wrapped client unchanged.
+type concurrencyLimitedClient struct {
+	SecretsManagerAPIClient
+	limiter *concurrencyLimiter
+}
+
+func (c *concurrencyLimitedClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.limiter.release()
+
+	return c.SecretsManagerAPIClient.GetSecretValue(ctx, params, optFns...)
+}
+
+func (c *concurrencyLimitedClient) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.limiter.release()
+
+	return c.SecretsManagerAPIClient.DescribeSecret(ctx, params, optFns...)
+}
+
+func (c *concurrencyLimitedClient) BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.limiter.release()
+
+	return callBatchGetSecretValue(ctx, c.SecretsManagerAPIClient, params, optFns...)
+}
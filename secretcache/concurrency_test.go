@@ -0,0 +1,174 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+)
+
+// A mock Client whose GetSecretValue calls record their secret id and then
+// wait for a value on release
+type gatedClient struct {
+	mockSecretsManagerClient
+	mux      sync.Mutex
+	started  []string
+	inFlight int
+	maxSeen  int
+	release  chan struct{}
+}
+
+func newGatedClient() *gatedClient {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	return &gatedClient{mockSecretsManagerClient: mockClient, release: make(chan struct{})}
+}
+
+func (m *gatedClient) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.mux.Lock()
+	m.started = append(m.started, aws.ToString(input.SecretId))
+	m.inFlight++
+	m.maxSeen = max(m.maxSeen, m.inFlight)
+	m.mux.Unlock()
+
+	<-m.release
+
+	m.mux.Lock()
+	m.inFlight--
+	m.mux.Unlock()
+
+	return m.MockedGetResult, nil
+}
+
+func (m *gatedClient) startedIds() []string {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	return slices.Clone(m.started)
+}
+
+func newConcurrencyLimitedCache(client secretcache.SecretsManagerAPIClient, limit int) *secretcache.Cache {
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithMaxConcurrentRequests(limit),
+	)
+
+	return secretCache
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	client := newGatedClient()
+	secretCache := newConcurrencyLimitedCache(client, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = secretCache.GetSecretString("secret-" + strconv.Itoa(i))
+		}()
+	}
+
+	waitFor(t, func() bool { return len(client.startedIds()) == 2 })
+	time.Sleep(10 * time.Millisecond)
+
+	if started := len(client.startedIds()); started != 2 {
+		t.Fatalf("Expected 2 calls in flight, got %d", started)
+	}
+
+	close(client.release)
+	wg.Wait()
+
+	if started := len(client.startedIds()); started != 5 {
+		t.Fatalf("Expected 5 calls, got %d", started)
+	}
+
+	if client.maxSeen != 2 {
+		t.Fatalf("Expected at most 2 calls in flight, got %d", client.maxSeen)
+	}
+}
+
+func TestMaxConcurrentRequestsForegroundFirst(t *testing.T) {
+	client := newGatedClient()
+	secretCache := newConcurrencyLimitedCache(client, 1)
+
+	var wg sync.WaitGroup
+	lookup := func(ctx context.Context, secretId string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = secretCache.GetSecretStringWithContext(ctx, secretId)
+		}()
+	}
+
+	lookup(context.Background(), "first")
+	waitFor(t, func() bool { return len(client.startedIds()) == 1 })
+
+	// The background call queues ahead of the foreground one but is overtaken.
+	lookup(secretcache.WithBackgroundPriority(context.Background()), "background")
+	time.Sleep(10 * time.Millisecond)
+	lookup(context.Background(), "foreground")
+	time.Sleep(10 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		client.release <- struct{}{}
+	}
+	wg.Wait()
+
+	expected := []string{"first", "foreground", "background"}
+	if started := client.startedIds(); !slices.Equal(started, expected) {
+		t.Fatalf("Expected calls in order %v, got %v", expected, started)
+	}
+}
+
+func TestMaxConcurrentRequestsAbandoned(t *testing.T) {
+	client := newGatedClient()
+	secretCache := newConcurrencyLimitedCache(client, 1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = secretCache.GetSecretString("first")
+	}()
+	waitFor(t, func() bool { return len(client.startedIds()) == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := secretCache.GetSecretStringWithContext(ctx, "abandoned"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to be exceeded, got %v", err)
+	}
+
+	client.release <- struct{}{}
+	<-done
+
+	go func() { client.release <- struct{}{} }()
+	if _, err := secretCache.GetSecretString("next"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	expected := []string{"first", "next"}
+	if started := client.startedIds(); !slices.Equal(started, expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, started)
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+// Package encryptinghook provides a secretcache.CacheHookV2 keeping cached
+// secrets encrypted in memory with AES-GCM.
+//
+// Values are sealed under data keys from a KeyProvider.  By default the keys
+// are random and never leave the process.  A provider can instead wrap the
+// keys with KMS, returning the plaintext and the encrypted copy of a key from
+// GenerateDataKey in NewDataKey, using the encrypted copy as the key's id, and
+// calling Decrypt in DecryptDataKey.
+package encryptinghook
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/smithy-go/middleware"
+)
+
+var _ secretcache.CacheHookV2 = (*Hook)(nil)
+var _ secretcache.CacheHookWiper = (*Hook)(nil)
+
+// maxSealsPerKey bounds the values sealed under one key, keeping the chance
+// of a repeated random nonce negligible.
+const maxSealsPerKey = 1 << 32
+
+// Hook is a secretcache.CacheHookV2 sealing secret values and descriptions with
+// AES-GCM before they are cached, and opening them again for each lookup.
+// Sealed values are bound to the secret and version they were cached for.
+// Plaintext buffers the hook allocates are wiped once used; the strings of
+// the objects it returns cannot be, and live until garbage collected.
+type Hook struct {
+	provider KeyProvider
+
+	mux     sync.Mutex
+	current *dataKeyCipher
+	ciphers map[string]cipher.AEAD
+}
+
+// dataKeyCipher is the cipher of the key new values are sealed under.
+type dataKeyCipher struct {
+	id    string
+	aead  cipher.AEAD
+	seals uint64
+}
+
+// sealed is what the hook hands to the cache to store.
+type sealed struct {
+	keyId      string
+	nonce      []byte
+	ciphertext []byte
+
+	// The secret value with SecretString and SecretBinary removed, for values.
+	value *secretsmanager.GetSecretValueOutput
+
+	// The result metadata, for descriptions.
+	metadata middleware.Metadata
+}
+
+// New returns a Hook sealing values under data keys from provider, or under
+// random per-process keys if provider is nil.
+func New(provider KeyProvider) *Hook {
+	if provider == nil {
+		provider = NewLocalKeyProvider()
+	}
+
+	return &Hook{provider: provider, ciphers: make(map[string]cipher.AEAD)}
+}
+
+// Rotate seals new values under a new data key.  Values already sealed can
+// still be opened, and are sealed under the new key when next refreshed.
+// The hook keeps the cipher of each key it used until told to Forget it.
+func (h *Hook) Rotate(ctx context.Context) error {
+	key, err := h.provider.NewDataKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(key.Plaintext)
+	if err != nil {
+		return err
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.ciphers[key.ID] = aead
+	h.current = &dataKeyCipher{id: key.ID, aead: aead}
+	return nil
+}
+
+// Forget discards the hook's cipher for the key with the given id, once values
+// sealed under it have been refreshed or are no longer needed.  Those values
+// can then only be opened if the provider still has the key.  Forgetting the
+// current key makes the next Put rotate to a new one.
+func (h *Hook) Forget(id string) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	delete(h.ciphers, id)
+	if h.current != nil && h.current.id == id {
+		h.current = nil
+	}
+}
+
+// Put seals a *secretsmanager.GetSecretValueOutput or *secretsmanager.DescribeSecretOutput.
+func (h *Hook) Put(ctx context.Context, info secretcache.HookInfo, data interface{}) (interface{}, error) {
+	var plaintext []byte
+	defer func() { clear(plaintext) }()
+
+	s := &sealed{}
+	switch value := data.(type) {
+	case nil:
+		return nil, nil
+	case *secretsmanager.GetSecretValueOutput:
+		plaintext = encodeSecret(value)
+		stripped := *value
+		stripped.SecretString, stripped.SecretBinary = nil, nil
+		s.value = &stripped
+	case *secretsmanager.DescribeSecretOutput:
+		var err error
+		if plaintext, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+		s.metadata = value.ResultMetadata
+	default:
+		return nil, fmt.Errorf("encryptinghook: cannot seal %T", data)
+	}
+
+	current, err := h.sealingKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.keyId = current.id
+	s.nonce = make([]byte, current.aead.NonceSize())
+	if _, err := rand.Read(s.nonce); err != nil {
+		return nil, err
+	}
+
+	s.ciphertext = current.aead.Seal(nil, s.nonce, plaintext, additionalData(info))
+	return s, nil
+}
+
+// Get opens a value sealed by Put.
+func (h *Hook) Get(ctx context.Context, info secretcache.HookInfo, data interface{}) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	s, ok := data.(*sealed)
+	if !ok {
+		return nil, fmt.Errorf("encryptinghook: cannot open %T", data)
+	}
+
+	if s.ciphertext == nil {
+		return nil, errors.New("encryptinghook: value was wiped")
+	}
+
+	aead, err := h.cipher(ctx, s.keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, s.nonce, s.ciphertext, additionalData(info))
+	defer clear(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.value != nil {
+		value := *s.value
+		if err := decodeSecret(plaintext, &value); err != nil {
+			return nil, err
+		}
+		return &value, nil
+	}
+
+	value := &secretsmanager.DescribeSecretOutput{}
+	if err := json.Unmarshal(plaintext, value); err != nil {
+		return nil, err
+	}
+
+	value.ResultMetadata = s.metadata
+	return value, nil
+}
+
+// Wipe scrubs a sealed value the cache is discarding.
+func (h *Hook) Wipe(data interface{}) {
+	if s, ok := data.(*sealed); ok {
+		clear(s.ciphertext)
+		s.ciphertext = nil
+	}
+}
+
+// sealingKey returns the key to seal a new value under, creating or rotating it when needed.
+func (h *Hook) sealingKey(ctx context.Context) (*dataKeyCipher, error) {
+	h.mux.Lock()
+	current := h.current
+	if current != nil && current.seals < maxSealsPerKey {
+		current.seals++
+		h.mux.Unlock()
+		return current, nil
+	}
+	h.mux.Unlock()
+
+	if err := h.Rotate(ctx); err != nil {
+		return nil, err
+	}
+
+	return h.sealingKey(ctx)
+}
+
+// cipher returns the cipher for the key with the given id, asking the provider for the key if needed.
+func (h *Hook) cipher(ctx context.Context, id string) (cipher.AEAD, error) {
+	h.mux.Lock()
+	aead, ok := h.ciphers[id]
+	h.mux.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	key, err := h.provider.DecryptDataKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if aead, err = newAEAD(key); err != nil {
+		return nil, err
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	h.ciphers[id] = aead
+	return aead, nil
+}
+
+// newAEAD builds an AES-GCM cipher and wipes the key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	defer clear(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds a sealed value to the cache entry it was stored in.
+func additionalData(info secretcache.HookInfo) []byte {
+	return fmt.Appendf(nil, "%s\x00%s\x00%s", info.Kind, info.SecretId, info.VersionId)
+}
+
+// Flags recording which secret fields encodeSecret found.
+const (
+	hasSecretString = 1 << iota
+	hasSecretBinary
+)
+
+// encodeSecret encodes the SecretString and SecretBinary of a secret value as
+// a flags byte, the length of the string, the string and then the binary.
+func encodeSecret(value *secretsmanager.GetSecretValueOutput) []byte {
+	var flags byte
+	var secretString string
+	if value.SecretString != nil {
+		flags |= hasSecretString
+		secretString = *value.SecretString
+	}
+	if value.SecretBinary != nil {
+		flags |= hasSecretBinary
+	}
+
+	plaintext := make([]byte, 0, 1+binary.MaxVarintLen64+len(secretString)+len(value.SecretBinary))
+	plaintext = append(plaintext, flags)
+	plaintext = binary.AppendUvarint(plaintext, uint64(len(secretString)))
+	plaintext = append(plaintext, secretString...)
+	return append(plaintext, value.SecretBinary...)
+}
+
+// decodeSecret sets the SecretString and SecretBinary of a secret value from
+// the output of encodeSecret.  The results do not share memory with plaintext.
+func decodeSecret(plaintext []byte, value *secretsmanager.GetSecretValueOutput) error {
+	if len(plaintext) == 0 {
+		return errors.New("encryptinghook: malformed secret")
+	}
+
+	flags := plaintext[0]
+	length, n := binary.Uvarint(plaintext[1:])
+	if n <= 0 || length > uint64(len(plaintext)-1-n) {
+		return errors.New("encryptinghook: malformed secret")
+	}
+
+	rest := plaintext[1+n:]
+	if flags&hasSecretString != 0 {
+		secretString := string(rest[:length])
+		value.SecretString = &secretString
+	}
+	if flags&hasSecretBinary != 0 {
+		value.SecretBinary = append([]byte{}, rest[length:]...)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package encryptinghook_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/encryptinghook"
+)
+
+var valueInfo = secretcache.HookInfo{SecretId: "dummy-secret-name", VersionId: "dummy-version", Kind: secretcache.HookKindValue}
+
+func TestSealValue(t *testing.T) {
+	hook := encryptinghook.New(nil)
+	ctx := context.Background()
+	value := &secretsmanager.GetSecretValueOutput{
+		Name:          aws.String("dummy-secret-name"),
+		SecretString:  aws.String("my secret string"),
+		SecretBinary:  []byte{0, 1, 2},
+		VersionStages: []string{"AWSCURRENT"},
+	}
+
+	data, err := hook.Put(ctx, valueInfo, value)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if _, ok := data.(*secretsmanager.GetSecretValueOutput); ok {
+		t.Fatalf("Expected the cached object to be sealed")
+	}
+
+	opened, err := hook.Get(ctx, valueInfo, data)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	result := opened.(*secretsmanager.GetSecretValueOutput)
+
+	if *result.SecretString != "my secret string" || !bytes.Equal(result.SecretBinary, value.SecretBinary) {
+		t.Fatalf("Expected the secret to round trip, got %q and %v", *result.SecretString, result.SecretBinary)
+	}
+
+	if *result.Name != "dummy-secret-name" || result.VersionStages[0] != "AWSCURRENT" {
+		t.Fatalf("Expected the metadata to round trip, got %+v", result)
+	}
+}
+
+func TestSealValueWithoutBinary(t *testing.T) {
+	hook := encryptinghook.New(nil)
+	ctx := context.Background()
+
+	data, _ := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("")})
+	opened, _ := hook.Get(ctx, valueInfo, data)
+	result := opened.(*secretsmanager.GetSecretValueOutput)
+
+	if result.SecretString == nil || *result.SecretString != "" || result.SecretBinary != nil {
+		t.Fatalf("Expected an empty string and no binary, got %+v", result)
+	}
+}
+
+func TestSealDescription(t *testing.T) {
+	hook := encryptinghook.New(nil)
+	ctx := context.Background()
+	info := secretcache.HookInfo{SecretId: "dummy-secret-name", Kind: secretcache.HookKindDescription}
+	desc := &secretsmanager.DescribeSecretOutput{
+		Name:               aws.String("dummy-secret-name"),
+		VersionIdsToStages: map[string][]string{"dummy-version": {"AWSCURRENT"}},
+	}
+
+	data, err := hook.Put(ctx, info, desc)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	opened, err := hook.Get(ctx, info, data)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	result := opened.(*secretsmanager.DescribeSecretOutput)
+
+	if *result.Name != "dummy-secret-name" || result.VersionIdsToStages["dummy-version"][0] != "AWSCURRENT" {
+		t.Fatalf("Expected the description to round trip, got %+v", result)
+	}
+}
+
+func TestSealedValueBoundToEntry(t *testing.T) {
+	hook := encryptinghook.New(nil)
+	ctx := context.Background()
+
+	data, _ := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("secret")})
+
+	other := valueInfo
+	other.SecretId = "other-secret-name"
+	if _, err := hook.Get(ctx, other, data); err == nil {
+		t.Fatalf("Expected opening under another secret id to fail")
+	}
+}
+
+func TestSealUnsupportedType(t *testing.T) {
+	hook := encryptinghook.New(nil)
+
+	if _, err := hook.Put(context.Background(), valueInfo, "plain string"); err == nil {
+		t.Fatalf("Expected an error for an unsupported type")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	provider := encryptinghook.NewLocalKeyProvider()
+	hook := encryptinghook.New(provider)
+	ctx := context.Background()
+
+	before, _ := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("before")})
+
+	if err := hook.Rotate(ctx); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	after, _ := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("after")})
+
+	for expected, data := range map[string]interface{}{"before": before, "after": after} {
+		opened, err := hook.Get(ctx, valueInfo, data)
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+
+		if secret := *opened.(*secretsmanager.GetSecretValueOutput).SecretString; secret != expected {
+			t.Fatalf("Expected %s, got %s", expected, secret)
+		}
+	}
+
+	// A hook without the key in memory asks the provider for it.
+	provider.Forget("local-1")
+	if _, err := encryptinghook.New(provider).Get(ctx, valueInfo, before); !errors.Is(err, encryptinghook.ErrUnknownKey) {
+		t.Fatalf("Expected ErrUnknownKey for a forgotten key, got %v", err)
+	}
+
+	if _, err := encryptinghook.New(provider).Get(ctx, valueInfo, after); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+}
+
+func TestForget(t *testing.T) {
+	provider := encryptinghook.NewLocalKeyProvider()
+	hook := encryptinghook.New(provider)
+	ctx := context.Background()
+
+	before, _ := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("before")})
+	_ = hook.Rotate(ctx)
+	after, _ := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("after")})
+
+	// The hook still holds the cipher of a key only the provider forgot.
+	provider.Forget("local-1")
+	if _, err := hook.Get(ctx, valueInfo, before); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	hook.Forget("local-1")
+	if _, err := hook.Get(ctx, valueInfo, before); !errors.Is(err, encryptinghook.ErrUnknownKey) {
+		t.Fatalf("Expected ErrUnknownKey for a forgotten key, got %v", err)
+	}
+
+	if _, err := hook.Get(ctx, valueInfo, after); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+}
+
+func TestForgetCurrentKey(t *testing.T) {
+	provider := encryptinghook.NewLocalKeyProvider()
+	hook := encryptinghook.New(provider)
+	ctx := context.Background()
+
+	_, _ = hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("before")})
+	provider.Forget("local-1")
+	hook.Forget("local-1")
+
+	// New values are sealed under a new key the provider still has.
+	data, err := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("after")})
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if _, err := encryptinghook.New(provider).Get(ctx, valueInfo, data); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+}
+
+type failingKeyProvider struct{}
+
+func (failingKeyProvider) NewDataKey(context.Context) (encryptinghook.DataKey, error) {
+	return encryptinghook.DataKey{}, errors.New("no keys today")
+}
+
+func (failingKeyProvider) DecryptDataKey(context.Context, string) ([]byte, error) {
+	return nil, errors.New("no keys today")
+}
+
+func TestKeyProviderError(t *testing.T) {
+	hook := encryptinghook.New(failingKeyProvider{})
+
+	if _, err := hook.Put(context.Background(), valueInfo, &secretsmanager.GetSecretValueOutput{}); err == nil {
+		t.Fatalf("Expected the provider error")
+	}
+}
+
+func TestWipe(t *testing.T) {
+	hook := encryptinghook.New(nil)
+	ctx := context.Background()
+
+	data, _ := hook.Put(ctx, valueInfo, &secretsmanager.GetSecretValueOutput{SecretString: aws.String("secret")})
+	hook.Wipe(data)
+
+	if _, err := hook.Get(ctx, valueInfo, data); err == nil {
+		t.Fatalf("Expected a wiped value not to open")
+	}
+}
+
+// A client serving a single secret value
+type secretClient struct {
+	secretcache.SecretsManagerAPIClient
+	value *secretsmanager.GetSecretValueOutput
+}
+
+func (c *secretClient) GetSecretValue(context.Context, *secretsmanager.GetSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return c.value, nil
+}
+
+func TestCacheWithEncryptingHook(t *testing.T) {
+	client := &secretClient{value: &secretsmanager.GetSecretValueOutput{
+		SecretString:  aws.String("my secret string"),
+		VersionId:     aws.String("dummy-version"),
+		VersionStages: []string{"AWSCURRENT"},
+	}}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithHookV2(encryptinghook.New(nil)),
+	)
+
+	for i := 0; i < 2; i++ {
+		value, err := secretCache.GetSecretString("dummy-secret-name")
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+
+		if value != "my secret string" {
+			t.Fatalf("Expected my secret string, got %s", value)
+		}
+	}
+}
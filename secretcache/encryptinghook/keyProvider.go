@@ -0,0 +1,107 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package encryptinghook
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// ErrUnknownKey is returned by LocalKeyProvider for key ids it did not create.
+var ErrUnknownKey = errors.New("unknown data key")
+
+// DataKey is an AES key used to seal cached values.
+type DataKey struct {
+	// ID identifies the key to KeyProvider.DecryptDataKey.  For a provider
+	// wrapping keys with KMS, it would hold the encrypted copy of the key.
+	ID string
+
+	// Plaintext is the AES-128, AES-192 or AES-256 key.  The hook wipes it
+	// once it has built its cipher.
+	Plaintext []byte
+}
+
+// KeyProvider supplies the data keys a Hook seals values with.
+type KeyProvider interface {
+	// NewDataKey returns a new data key.  The hook asks for one when it is
+	// first used and whenever it rotates its key.
+	NewDataKey(ctx context.Context) (DataKey, error)
+
+	// DecryptDataKey returns the plaintext of the data key with the given id.
+	// The hook asks for it when opening a value sealed under a key it no
+	// longer holds, and wipes the returned slice once it has built its cipher.
+	DecryptDataKey(ctx context.Context, id string) ([]byte, error)
+}
+
+// LocalKeyProvider generates random AES-256 data keys and keeps them in
+// process memory, so sealed values cannot be opened by another process.  It is
+// the provider used by New by default, and a stand-in for a KMS-backed
+// provider in tests.
+type LocalKeyProvider struct {
+	mux  sync.Mutex
+	keys map[string][]byte
+	next int
+}
+
+// NewLocalKeyProvider returns a LocalKeyProvider holding no keys.
+func NewLocalKeyProvider() *LocalKeyProvider {
+	return &LocalKeyProvider{keys: make(map[string][]byte)}
+}
+
+// NewDataKey generates a random data key.
+func (p *LocalKeyProvider) NewDataKey(context.Context) (DataKey, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return DataKey{}, err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.next++
+	id := "local-" + strconv.Itoa(p.next)
+	p.keys[id] = key
+	return DataKey{ID: id, Plaintext: slices.Clone(key)}, nil
+}
+
+// DecryptDataKey returns a copy of a key previously returned by NewDataKey.
+func (p *LocalKeyProvider) DecryptDataKey(_ context.Context, id string) ([]byte, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	return slices.Clone(key), nil
+}
+
+// Forget wipes and discards the key with the given id.  Values sealed under it
+// can no longer be opened by a Hook that has not kept the key's cipher; call
+// Hook.Forget too to drop it from a hook that has.
+func (p *LocalKeyProvider) Forget(id string) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if key, ok := p.keys[id]; ok {
+		clear(key)
+		delete(p.keys, id)
+	}
+}
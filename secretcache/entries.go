@@ -0,0 +1,162 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"iter"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Entry describes a cached secret for debugging.  It never holds secret values.
+type Entry struct {
+	SecretId string
+
+	// The version id attached to each version stage, as cached.
+	Stages map[string]string
+
+	// The time of the last successful refresh, or zero if there was none.
+	LastRefreshTime time.Time
+
+	// The time after which the next lookup refreshes the secret.  With
+	// DirectStageLookup, the earliest of the times of its version stages.
+	NextRefreshTime time.Time
+
+	// The number of consecutive failed refreshes, and the error of the last one,
+	// of the secret's description or of the cached version with the most.
+	ErrorCount int
+	LastError  error
+
+	// The time before which a failed refresh is not retried, or zero when the
+	// last refresh succeeded.
+	BackoffUntil time.Time
+
+	// Set when the last refresh failed while an earlier value is still served.
+	Stale bool
+
+	// The position of the secret in the cache's eviction order when the
+	// iteration started, 0 being the most recently used.
+	LRUPosition int
+
+	// The region that served the last refresh, when the client is a FailoverClient.
+	Region string
+
+	// Set when the secret was being looked up or refreshed, in which case only
+	// SecretId and LRUPosition are known.
+	Busy bool
+}
+
+// Entries returns an iterator over the cached secrets, most recently used
+// first.  Iterating does not count as using the secrets, and does not wait for
+// lookups in progress: their secrets are reported as Busy.  Secrets evicted
+// while iterating are skipped.
+func (c *Cache) Entries() iter.Seq[Entry] {
+	return func(yield func(Entry) bool) {
+		for position, secretId := range c.lru.keys() {
+			data, found := c.lru.peek(secretId)
+			if !found {
+				continue
+			}
+
+			entry := data.(*secretCacheItem).entry()
+			entry.LRUPosition = position
+			if !yield(entry) {
+				return
+			}
+		}
+	}
+}
+
+// entry describes the item, or reports it busy if it is locked.
+func (ci *secretCacheItem) entry() Entry {
+	if !ci.mux.TryLock() {
+		return Entry{SecretId: ci.secretId, Busy: true}
+	}
+	defer ci.unlock()
+
+	entry := Entry{
+		SecretId:        ci.secretId,
+		LastRefreshTime: unixNanoTime(ci.lastRefreshTime),
+		NextRefreshTime: unixNanoTime(ci.nextRefreshTime),
+		ErrorCount:      ci.errorCount,
+		LastError:       ci.err,
+		Region:          ci.region,
+	}
+
+	if ci.err != nil {
+		entry.BackoffUntil = unixNanoTime(ci.nextRetryTime)
+	}
+
+	if ci.config.DirectStageLookup && len(ci.stageRefreshTimes) > 0 {
+		var earliest int64
+		for _, nextRefreshTime := range ci.stageRefreshTimes {
+			if earliest == 0 || nextRefreshTime < earliest {
+				earliest = nextRefreshTime
+			}
+		}
+		entry.NextRefreshTime = unixNanoTime(earliest)
+	}
+
+	// The description holds no secret values, so the hook is asked for it.
+	if description, err := ci.getWithHook(context.Background()); description != nil && err == nil {
+		entry.Stages = make(map[string]string)
+		for versionId, stages := range description.VersionIdsToStages {
+			for _, stage := range stages {
+				entry.Stages[stage] = versionId
+			}
+		}
+	}
+
+	cached := ci.mergeVersionErrors(&entry)
+	entry.Stale = entry.LastError != nil && cached
+	return entry
+}
+
+// mergeVersionErrors reports in entry the error of the version its stages point
+// to with the most consecutive failed refreshes, if it has more than the item.
+// Returns whether any of those versions holds a value.  The caller must hold the lock.
+func (ci *secretCacheItem) mergeVersionErrors(entry *Entry) bool {
+	versionIds := slices.Sorted(maps.Values(entry.Stages))
+	cached := false
+
+	for _, versionId := range slices.Compact(versionIds) {
+		data, found := ci.versions.peek(versionId)
+		if !found {
+			continue
+		}
+
+		version := data.(*cacheVersion)
+		version.mux.Lock()
+		cached = cached || version.data != nil
+		if version.err != nil && version.errorCount > entry.ErrorCount {
+			entry.ErrorCount = version.errorCount
+			entry.LastError = version.err
+			entry.BackoffUntil = unixNanoTime(version.nextRetryTime)
+		}
+		version.mux.Unlock()
+	}
+
+	return cached
+}
+
+// unixNanoTime converts nanoseconds since the epoch to a time, or to the zero time if zero.
+func unixNanoTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+func entryIds(secretCache *secretcache.Cache) []string {
+	var ids []string
+	for entry := range secretCache.Entries() {
+		ids = append(ids, entry.SecretId)
+	}
+
+	return ids
+}
+
+func TestEntries(t *testing.T) {
+	mockClient, _, secretString := newMockedClientWithDummyResults()
+	start := time.Now()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(secretcachetest.NewFakeClock(start)),
+	)
+
+	_, _ = secretCache.GetSecretString("first")
+	_, _ = secretCache.GetSecretString("second")
+	_, _ = secretCache.GetSecretString("first")
+
+	entries := slices.Collect(secretCache.Entries())
+
+	if len(entries) != 2 || entries[0].SecretId != "first" || entries[1].SecretId != "second" {
+		t.Fatalf("Expected first and second, most recent first, got %+v", entries)
+	}
+
+	entry := entries[0]
+
+	if entry.LRUPosition != 0 || entries[1].LRUPosition != 1 {
+		t.Fatalf("Expected LRU positions 0 and 1, got %d and %d", entry.LRUPosition, entries[1].LRUPosition)
+	}
+
+	if entry.Stages["AWSCURRENT"] != "very-random-uuid" || entry.Stages["AWSPREVIOUS"] != "other-random-uuid" {
+		t.Fatalf("Expected the cached stages, got %v", entry.Stages)
+	}
+
+	if !entry.LastRefreshTime.Equal(start) || !entry.NextRefreshTime.After(start) {
+		t.Fatalf("Expected a refresh at %s and another later, got %s and %s", start, entry.LastRefreshTime, entry.NextRefreshTime)
+	}
+
+	if entry.ErrorCount != 0 || entry.LastError != nil || !entry.BackoffUntil.IsZero() {
+		t.Fatalf("Expected no errors, got %+v", entry)
+	}
+
+	if strings.Contains(fmt.Sprintf("%+v", entries), secretString) {
+		t.Fatalf("Expected entries not to hold secret values")
+	}
+
+	// Iterating leaves the eviction order alone.
+	if ids := entryIds(secretCache); !slices.Equal(ids, []string{"first", "second"}) {
+		t.Fatalf("Expected the order to be unchanged, got %v", ids)
+	}
+}
+
+func TestEntriesFailedRefresh(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = errors.New("describe failed")
+	start := time.Now()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(secretcachetest.NewFakeClock(start)),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	for entry := range secretCache.Entries() {
+		if entry.ErrorCount != 1 || entry.LastError != mockClient.DescribeSecretErr {
+			t.Fatalf("Expected the failed refresh, got %+v", entry)
+		}
+
+		if !entry.BackoffUntil.After(start) || !entry.LastRefreshTime.IsZero() || entry.Stages != nil {
+			t.Fatalf("Expected a backoff and nothing cached, got %+v", entry)
+		}
+	}
+}
+
+func TestEntriesStopEarly(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	for _, secretId := range []string{"a", "b", "c"} {
+		_, _ = secretCache.GetSecretString(secretId)
+	}
+
+	var seen []string
+	for entry := range secretCache.Entries() {
+		seen = append(seen, entry.SecretId)
+		if len(seen) == 2 {
+			break
+		}
+	}
+
+	if !slices.Equal(seen, []string{"c", "b"}) {
+		t.Fatalf("Expected c and b, got %v", seen)
+	}
+}
+
+func TestEntriesBusy(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+	)
+
+	lookup := make(chan error, 1)
+	go func() {
+		_, err := secretCache.GetSecretString("busy")
+		lookup <- err
+	}()
+	waitFor(t, func() bool { return client.calls.Load() == 1 })
+
+	entries := slices.Collect(secretCache.Entries())
+	if len(entries) != 1 || !entries[0].Busy || entries[0].SecretId != "busy" {
+		t.Fatalf("Expected the secret being looked up to be busy, got %+v", entries)
+	}
+
+	close(client.release)
+	if err := <-lookup; err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if entries := slices.Collect(secretCache.Entries()); entries[0].Busy || len(entries[0].Stages) == 0 {
+		t.Fatalf("Expected the secret to be described once looked up, got %+v", entries)
+	}
+}
+
+func TestEntriesFailedVersionRefresh(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.GetSecretValueErr = errors.New("access denied")
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	for entry := range secretCache.Entries() {
+		if entry.ErrorCount != 1 || entry.LastError != mockClient.GetSecretValueErr || entry.BackoffUntil.IsZero() {
+			t.Fatalf("Expected the failed value refresh, got %+v", entry)
+		}
+
+		if entry.Stale {
+			t.Fatalf("Expected no value to be served, got %+v", entry)
+		}
+	}
+}
+
+func TestEntriesStale(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithTTL(time.Minute),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	mockClient.DescribeSecretErr = errors.New("describe failed")
+	clock.Advance(time.Minute)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	for entry := range secretCache.Entries() {
+		if !entry.Stale || entry.LastError != mockClient.DescribeSecretErr {
+			t.Fatalf("Expected a stale entry, got %+v", entry)
+		}
+	}
+}
@@ -13,6 +13,12 @@
 
 package secretcache
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 type baseError struct {
 	Message string
 }
@@ -40,3 +46,125 @@ type InvalidOperationError struct {
 func (i *InvalidOperationError) Error() string {
 	return i.Message
 }
+
+// ErrSecretDeleted is matched by errors.Is for any *SecretDeletedError.
+var ErrSecretDeleted = errors.New("secret is scheduled for deletion")
+
+// SecretDeletedError is returned when looking up a secret that is scheduled for
+// deletion and DeletedSecretPolicy is DeletedSecretFail.
+type SecretDeletedError struct {
+	baseError
+
+	// The secret id that was looked up.
+	SecretId string
+
+	// The date the secret was marked for deletion.  Zero with DirectStageLookup,
+	// as the GetSecretValue error for a deleted secret does not report it.
+	DeletedDate time.Time
+}
+
+func (s *SecretDeletedError) Error() string {
+	return s.Message
+}
+
+// Is reports whether target is ErrSecretDeleted.
+func (s *SecretDeletedError) Is(target error) bool {
+	return target == ErrSecretDeleted
+}
+
+// BatchError reports the secrets that failed in an operation on several secrets.
+type BatchError struct {
+	baseError
+
+	// The error for each failed secret, keyed by secret id.  Prefetch keys the
+	// failure of a call for its filters by an empty secret id.
+	Errors map[string]error
+}
+
+func (b *BatchError) Error() string {
+	return b.Message
+}
+
+// Unwrap returns the errors of the failed secrets.
+func (b *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(b.Errors))
+	for _, err := range b.Errors {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// newBatchError returns a *BatchError for the given errors, or nil if there are none.
+func newBatchError(errs map[string]error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &BatchError{
+		baseError: baseError{
+			Message: fmt.Sprintf("failed to get %d secrets", len(errs)),
+		},
+		Errors: errs,
+	}
+}
+
+// RateLimitExceededError is returned by a refresh that was skipped because the
+// cache's rate limit was used up while a cached value could still be served.
+type RateLimitExceededError struct {
+	baseError
+}
+
+func (r *RateLimitExceededError) Error() string {
+	return r.Message
+}
+
+// CircuitOpenError is returned for calls to AWS Secrets Manager that the cache's
+// circuit breaker stopped after consecutive failures.  Cached values keep being
+// served while the circuit is open.
+type CircuitOpenError struct {
+	baseError
+}
+
+func (c *CircuitOpenError) Error() string {
+	return c.Message
+}
+
+// HookError is returned when the cache's hook fails, or returns an object of
+// the wrong type, for the object described by HookInfo.
+type HookError struct {
+	baseError
+	HookInfo
+
+	// The error returned by the hook.
+	Err error
+}
+
+func (h *HookError) Error() string {
+	return h.Message
+}
+
+func (h *HookError) Unwrap() error {
+	return h.Err
+}
+
+// NotReadyError is returned by WaitReady when its context ends before every
+// secret was fetched.
+type NotReadyError struct {
+	baseError
+
+	// The last lookup error of each secret that is not ready, keyed by secret id.
+	Errors map[string]error
+
+	// The error of the context.
+	Err error
+}
+
+func (n *NotReadyError) Error() string {
+	return n.Message
+}
+
+// Unwrap returns the error of the context.
+func (n *NotReadyError) Unwrap() error {
+	return n.Err
+}
@@ -0,0 +1,330 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// The time a region that failed is skipped before reads are sent to it again, by default.
+const DefaultFailbackAfter = 30 * time.Second
+
+// RegionalClient is a client for AWS Secrets Manager in a single region.
+type RegionalClient struct {
+	Region string
+	Client SecretsManagerAPIClient
+}
+
+// FailoverClient is a SecretsManagerAPIClient that reads secrets from a primary
+// region and fails over to the replica regions it was created with, when the
+// primary times out or returns a 5xx error.  The replicas are not looked up
+// from a secret's ReplicationStatus, so they must be the regions the secrets
+// are replicated to.  Use NewFailoverClient to create one.
+// A region that failed is skipped until FailbackAfter has passed, after which
+// reads are sent to it again.
+//
+// GetSecretValue and DescribeSecret fail over; secret ARNs are rewritten for
+// the replica region. ListSecrets, whose page tokens are specific to a region,
+// and write operations always go to the primary region.
+//
+// The region that served a response is recorded in its ResultMetadata and can be
+// read with ServedRegion; the cache keeps it with each cached value.
+type FailoverClient struct {
+	// How long a region that failed is skipped.  Defaults to DefaultFailbackAfter.
+	FailbackAfter time.Duration
+
+	// The timeout of a single attempt in one region.  When zero, an attempt
+	// lasts as long as the caller's context allows.
+	AttemptTimeout time.Duration
+
+	// The source of time used to track failed regions.  Defaults to the system clock.
+	Clock Clock
+
+	// Used to report failovers and failbacks.  Nothing is logged when unset.
+	Logger *slog.Logger
+
+	regions []*regionState
+	mux     sync.Mutex
+}
+
+var _ SecretsManagerAPIClient = (*FailoverClient)(nil)
+
+// regionState tracks the health of one region of a FailoverClient.
+type regionState struct {
+	RegionalClient
+	unhealthyUntil time.Time
+}
+
+// NewFailoverClient returns a FailoverClient reading from primary and failing over
+// to replicas in the given order.
+func NewFailoverClient(primary RegionalClient, replicas ...RegionalClient) *FailoverClient {
+	regions := []*regionState{{RegionalClient: primary}}
+	for _, replica := range replicas {
+		regions = append(regions, &regionState{RegionalClient: replica})
+	}
+
+	return &FailoverClient{regions: regions}
+}
+
+// ServedRegion returns the region recorded by a FailoverClient in the metadata of
+// a response, or an empty string if the response did not come from one.
+func ServedRegion(metadata middleware.Metadata) string {
+	region, _ := metadata.Get(servedRegionKey{}).(string)
+	return region
+}
+
+// servedRegionKey is the ResultMetadata key of the region that served a response.
+type servedRegionKey struct{}
+
+func (f *FailoverClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return failover(f, ctx, func(ctx context.Context, region *regionState) (*secretsmanager.GetSecretValueOutput, error) {
+		input := *params
+		input.SecretId = regionalSecretId(params.SecretId, region.Region)
+
+		output, err := region.Client.GetSecretValue(ctx, &input, optFns...)
+		if err == nil {
+			output.ResultMetadata.Set(servedRegionKey{}, region.Region)
+		}
+
+		return output, err
+	})
+}
+
+func (f *FailoverClient) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	return failover(f, ctx, func(ctx context.Context, region *regionState) (*secretsmanager.DescribeSecretOutput, error) {
+		input := *params
+		input.SecretId = regionalSecretId(params.SecretId, region.Region)
+
+		output, err := region.Client.DescribeSecret(ctx, &input, optFns...)
+		if err == nil {
+			output.ResultMetadata.Set(servedRegionKey{}, region.Region)
+		}
+
+		return output, err
+	})
+}
+
+func (f *FailoverClient) ListSecrets(ctx context.Context, params *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	client, err := f.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.ListSecrets(ctx, params, optFns...)
+}
+
+func (f *FailoverClient) CreateSecret(ctx context.Context, params *secretsmanager.CreateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.CreateSecretOutput, error) {
+	client, err := f.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.CreateSecret(ctx, params, optFns...)
+}
+
+func (f *FailoverClient) DeleteSecret(ctx context.Context, params *secretsmanager.DeleteSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DeleteSecretOutput, error) {
+	client, err := f.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.DeleteSecret(ctx, params, optFns...)
+}
+
+func (f *FailoverClient) UpdateSecret(ctx context.Context, params *secretsmanager.UpdateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretOutput, error) {
+	client, err := f.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.UpdateSecret(ctx, params, optFns...)
+}
+
+// failover calls each region in turn, healthy regions first in configured order,
+// until one succeeds or returns an error that another region would not fix.
+// Returns the first successful output, or the last error.
+func failover[T any](f *FailoverClient, ctx context.Context, call func(context.Context, *regionState) (T, error)) (T, error) {
+	var output T
+	if len(f.regions) == 0 {
+		return output, errNoRegions()
+	}
+
+	var err error
+	for _, region := range f.orderedRegions() {
+		output, err = attempt(f, ctx, region, call)
+
+		if err == nil {
+			f.markHealthy(region)
+			return output, nil
+		}
+
+		if ctx.Err() != nil || !isServiceFailure(err) {
+			return output, err
+		}
+
+		f.markUnhealthy(region, err)
+	}
+
+	return output, err
+}
+
+// primary returns the client of the primary region.
+// Returns an *InvalidConfigError if the client has no regions.
+func (f *FailoverClient) primary() (SecretsManagerAPIClient, error) {
+	if len(f.regions) == 0 {
+		return nil, errNoRegions()
+	}
+
+	return f.regions[0].Client, nil
+}
+
+// errNoRegions is returned by the methods of a FailoverClient not created with NewFailoverClient.
+func errNoRegions() error {
+	return &InvalidConfigError{
+		baseError{
+			Message: "failover client has no regions, create it with NewFailoverClient",
+		},
+	}
+}
+
+// attempt runs call against a single region, bounded by AttemptTimeout.
+func attempt[T any](f *FailoverClient, ctx context.Context, region *regionState, call func(context.Context, *regionState) (T, error)) (T, error) {
+	if f.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.AttemptTimeout)
+		defer cancel()
+	}
+
+	return call(ctx, region)
+}
+
+// orderedRegions returns the healthy regions followed by the unhealthy ones,
+// each in configured order.
+func (f *FailoverClient) orderedRegions() []*regionState {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	now := f.clock().Now()
+	healthy := make([]*regionState, 0, len(f.regions))
+	var unhealthy []*regionState
+
+	for _, region := range f.regions {
+		if now.Before(region.unhealthyUntil) {
+			unhealthy = append(unhealthy, region)
+		} else {
+			healthy = append(healthy, region)
+		}
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// UnhealthyRegions returns the regions currently skipped after failing, in
+// configured order.
+func (f *FailoverClient) UnhealthyRegions() []string {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	now := f.clock().Now()
+	var unhealthy []string
+	for _, region := range f.regions {
+		if now.Before(region.unhealthyUntil) {
+			unhealthy = append(unhealthy, region.Region)
+		}
+	}
+
+	return unhealthy
+}
+
+// markUnhealthy skips the region for FailbackAfter.
+func (f *FailoverClient) markUnhealthy(region *regionState, err error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	failbackAfter := f.FailbackAfter
+	if failbackAfter == 0 {
+		failbackAfter = DefaultFailbackAfter
+	}
+
+	region.unhealthyUntil = f.clock().Now().Add(failbackAfter)
+	f.logger().Warn("failing over from region", "region", region.Region, "error", err)
+}
+
+// markHealthy clears the failure of a region that served a request.
+func (f *FailoverClient) markHealthy(region *regionState) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if !region.unhealthyUntil.IsZero() {
+		region.unhealthyUntil = time.Time{}
+		f.logger().Info("region is healthy again", "region", region.Region)
+	}
+}
+
+func (f *FailoverClient) clock() Clock {
+	return CacheConfig{Clock: f.Clock}.clock()
+}
+
+func (f *FailoverClient) logger() *slog.Logger {
+	return CacheConfig{Logger: f.Logger}.logger()
+}
+
+// isServiceFailure reports whether err is a timeout, a network error or a
+// server error, meaning that the endpoint called may be unavailable.
+func isServiceFailure(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	var statusErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &statusErr) && statusErr.HTTPStatusCode() >= 500
+}
+
+// regionalSecretId rewrites the region of a secret ARN.  Secret names are the
+// same in every replica region and are returned unchanged, as is everything
+// when the region is empty.
+func regionalSecretId(secretId *string, region string) *string {
+	if secretId == nil || region == "" || !strings.HasPrefix(*secretId, "arn:") {
+		return secretId
+	}
+
+	// arn:partition:secretsmanager:region:account:secret:name
+	parts := strings.SplitN(*secretId, ":", 5)
+	if len(parts) < 5 {
+		return secretId
+	}
+
+	parts[3] = region
+	regional := strings.Join(parts, ":")
+	return &regional
+}
@@ -0,0 +1,301 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// A mock Client for a single region that can be made to hang until its context is done
+type mockRegionalClient struct {
+	mockSecretsManagerClient
+	Hang bool
+}
+
+func newMockedRegionalClient() *mockRegionalClient {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	return &mockRegionalClient{mockSecretsManagerClient: mockClient}
+}
+
+func (m *mockRegionalClient) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if m.Hang {
+		m.GetSecretValueCallCount++
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	return m.mockSecretsManagerClient.GetSecretValue(ctx, input, optFns...)
+}
+
+func newServerError(statusCode int) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+		Err:      errors.New(http.StatusText(statusCode)),
+	}
+}
+
+func TestFailoverClientServesFromPrimary(t *testing.T) {
+	primary := newMockedRegionalClient()
+	replica := newMockedRegionalClient()
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+
+	output, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String("name")})
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if region := secretcache.ServedRegion(output.ResultMetadata); region != "us-east-1" {
+		t.Fatalf("Expected us-east-1 to serve the secret, got %q", region)
+	}
+
+	if replica.GetSecretValueCallCount != 0 {
+		t.Fatalf("Expected no calls to the replica, got %d", replica.GetSecretValueCallCount)
+	}
+}
+
+func TestFailoverClientFailsOverAndBack(t *testing.T) {
+	clock := secretcachetest.NewFakeClock(time.Now())
+	primary := newMockedRegionalClient()
+	primary.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	replica := newMockedRegionalClient()
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+	client.Clock = clock
+	client.FailbackAfter = time.Minute
+	input := &secretsmanager.DescribeSecretInput{SecretId: aws.String("name")}
+
+	output, err := client.DescribeSecret(context.Background(), input)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if region := secretcache.ServedRegion(output.ResultMetadata); region != "us-west-2" {
+		t.Fatalf("Expected us-west-2 to serve the secret, got %q", region)
+	}
+
+	// The primary is skipped while unhealthy.
+	if _, err = client.DescribeSecret(context.Background(), input); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if primary.DescribeSecretCallCount != 1 || replica.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected 1 primary and 2 replica calls, got %d and %d", primary.DescribeSecretCallCount, replica.DescribeSecretCallCount)
+	}
+
+	if regions := client.UnhealthyRegions(); len(regions) != 1 || regions[0] != "us-east-1" {
+		t.Fatalf("Expected us-east-1 to be unhealthy, got %v", regions)
+	}
+
+	// Once the health window has passed, reads go back to the primary.
+	primary.DescribeSecretErr = nil
+	clock.Advance(time.Minute)
+
+	output, err = client.DescribeSecret(context.Background(), input)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if region := secretcache.ServedRegion(output.ResultMetadata); region != "us-east-1" {
+		t.Fatalf("Expected us-east-1 to serve the secret after failback, got %q", region)
+	}
+
+	if regions := client.UnhealthyRegions(); len(regions) != 0 {
+		t.Fatalf("Expected no unhealthy regions, got %v", regions)
+	}
+}
+
+func TestFailoverClientAllRegionsFail(t *testing.T) {
+	primary := newMockedRegionalClient()
+	primary.GetSecretValueErr = newServerError(http.StatusInternalServerError)
+	replica := newMockedRegionalClient()
+	replica.GetSecretValueErr = newServerError(http.StatusBadGateway)
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+
+	_, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String("name")})
+
+	if err != replica.GetSecretValueErr {
+		t.Fatalf("Expected the replica's error, got %v", err)
+	}
+
+	// Every region is unhealthy, so all of them are tried again in order.
+	_, _ = client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String("name")})
+
+	if primary.GetSecretValueCallCount != 2 || replica.GetSecretValueCallCount != 2 {
+		t.Fatalf("Expected 2 calls to each region, got %d and %d", primary.GetSecretValueCallCount, replica.GetSecretValueCallCount)
+	}
+}
+
+func TestFailoverClientDoesNotFailOverOnClientErrors(t *testing.T) {
+	primary := newMockedRegionalClient()
+	primary.GetSecretValueErr = newServerError(http.StatusBadRequest)
+	replica := newMockedRegionalClient()
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+
+	_, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String("name")})
+
+	if err != primary.GetSecretValueErr {
+		t.Fatalf("Expected the primary's error, got %v", err)
+	}
+
+	if replica.GetSecretValueCallCount != 0 {
+		t.Fatalf("Expected no calls to the replica, got %d", replica.GetSecretValueCallCount)
+	}
+}
+
+func TestFailoverClientAttemptTimeout(t *testing.T) {
+	primary := newMockedRegionalClient()
+	primary.Hang = true
+	replica := newMockedRegionalClient()
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+	client.AttemptTimeout = 10 * time.Millisecond
+
+	output, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String("name")})
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if region := secretcache.ServedRegion(output.ResultMetadata); region != "us-west-2" {
+		t.Fatalf("Expected us-west-2 to serve the secret, got %q", region)
+	}
+}
+
+func TestFailoverClientCallerCancellation(t *testing.T) {
+	primary := newMockedRegionalClient()
+	primary.Hang = true
+	replica := newMockedRegionalClient()
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String("name")})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the caller's deadline to be exceeded, got %v", err)
+	}
+
+	if replica.GetSecretValueCallCount != 0 {
+		t.Fatalf("Expected no calls to the replica, got %d", replica.GetSecretValueCallCount)
+	}
+}
+
+func TestFailoverClientRewritesSecretArn(t *testing.T) {
+	primary := newMockedRegionalClient()
+	primary.GetSecretValueErr = newServerError(http.StatusServiceUnavailable)
+	replica := newMockedRegionalClient()
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+	arn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:name-AbCdEf"
+
+	_, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String(arn)})
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	expected := "arn:aws:secretsmanager:us-west-2:123456789012:secret:name-AbCdEf"
+	if actual := aws.ToString(replica.GetSecretValueInputs[0].SecretId); actual != expected {
+		t.Fatalf("Expected secret id %s, got %s", expected, actual)
+	}
+
+	if actual := aws.ToString(primary.GetSecretValueInputs[0].SecretId); actual != arn {
+		t.Fatalf("Expected secret id %s, got %s", arn, actual)
+	}
+}
+
+func TestCacheWithFailoverClient(t *testing.T) {
+	var logs bytes.Buffer
+	clock := secretcachetest.NewFakeClock(time.Now())
+	primary := newMockedRegionalClient()
+	replica := newMockedRegionalClient()
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: replica},
+	)
+	client.Clock = clock
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithClock(clock),
+		secretcache.WithTTL(time.Minute),
+		secretcache.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+
+	if _, err := secretCache.GetSecretString("dummy-secret-name"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	primary.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	clock.Advance(time.Minute)
+
+	if _, err := secretCache.GetSecretString("dummy-secret-name"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if replica.DescribeSecretCallCount != 1 {
+		t.Fatalf("Expected the refresh to be served by the replica, got %d calls", replica.DescribeSecretCallCount)
+	}
+
+	if !strings.Contains(logs.String(), "region=us-west-2 previousRegion=us-east-1") {
+		t.Fatalf("Expected the region change to be logged, got %q", logs.String())
+	}
+}
+
+func TestFailoverClientWithoutRegions(t *testing.T) {
+	client := &secretcache.FailoverClient{}
+
+	var configErr *secretcache.InvalidConfigError
+	if _, err := client.GetSecretValue(context.Background(), &secretsmanager.GetSecretValueInput{SecretId: aws.String("name")}); !errors.As(err, &configErr) {
+		t.Fatalf("Expected InvalidConfigError, got %v", err)
+	}
+
+	if _, err := client.ListSecrets(context.Background(), &secretsmanager.ListSecretsInput{}); !errors.As(err, &configErr) {
+		t.Fatalf("Expected InvalidConfigError, got %v", err)
+	}
+}
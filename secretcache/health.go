@@ -0,0 +1,301 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// The shortest time WaitReady waits before looking up a secret that is not ready again.
+const minReadyRetryDelay = 100 * time.Millisecond
+
+// HealthStatus summarises the health of a cache.
+type HealthStatus int
+
+const (
+	// HealthOK caches can reach AWS Secrets Manager and have no failing secrets.
+	HealthOK HealthStatus = iota
+
+	// HealthDegraded caches have failing secrets, failed regions or a half-open
+	// circuit breaker, but still serve some secrets.
+	HealthDegraded
+
+	// HealthUnhealthy caches have an open circuit breaker, or cannot serve any
+	// of their secrets.
+	HealthUnhealthy
+)
+
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthOK:
+		return "ok"
+	case HealthDegraded:
+		return "degraded"
+	case HealthUnhealthy:
+		return "unhealthy"
+	default:
+		return fmt.Sprintf("HealthStatus(%d)", int(s))
+	}
+}
+
+// Health is a report on whether a cache can reach AWS Secrets Manager.
+type Health struct {
+	Status HealthStatus
+
+	// The state of the cache's circuit breaker.
+	CircuitState CircuitState
+
+	// The regions skipped after failing, when the client is a FailoverClient.
+	UnhealthyRegions []string
+
+	// The error of the last refresh of each cached secret whose description or
+	// cached values failed to refresh, keyed by secret id.
+	FailingSecrets map[string]error
+
+	// The number of cached secrets.
+	Entries int
+
+	// The number of failing secrets still served from an earlier refresh.
+	StaleEntries int
+
+	// The number of secrets being looked up or refreshed, whose state is not
+	// known yet.  They are not counted as failing.
+	BusyEntries int
+}
+
+// Health reports the health of the cache from its cached secrets and circuit
+// breaker, without calling AWS Secrets Manager.  Like Entries, it does not wait
+// for lookups in progress, counting their secrets as busy.
+// Returns the error of ctx if it ends first.
+func (c *Cache) Health(ctx context.Context) (Health, error) {
+	health := Health{
+		CircuitState:   c.Stats().CircuitState,
+		FailingSecrets: make(map[string]error),
+	}
+
+	if failover, ok := c.Client.(*FailoverClient); ok {
+		health.UnhealthyRegions = failover.UnhealthyRegions()
+	}
+
+	for entry := range c.Entries() {
+		if err := ctx.Err(); err != nil {
+			return Health{}, err
+		}
+
+		health.Entries++
+		if entry.Busy {
+			health.BusyEntries++
+		}
+		if entry.LastError == nil {
+			continue
+		}
+
+		health.FailingSecrets[entry.SecretId] = entry.LastError
+		if entry.Stale {
+			health.StaleEntries++
+		}
+	}
+
+	switch failing := len(health.FailingSecrets); {
+	case health.CircuitState == CircuitOpen:
+		health.Status = HealthUnhealthy
+	case failing > 0 && failing == health.Entries && health.StaleEntries == 0:
+		health.Status = HealthUnhealthy
+	case failing > 0 || health.CircuitState == CircuitHalfOpen || len(health.UnhealthyRegions) > 0:
+		health.Status = HealthDegraded
+	}
+
+	return health, nil
+}
+
+// WaitReady blocks until each of the given secrets has been fetched once for
+// the configured version stage, looking up the secrets that are not cached and
+// retrying failed lookups once their backoff has passed.
+// Returns a *NotReadyError, wrapping the error of ctx, if ctx ends first.
+func (c *Cache) WaitReady(ctx context.Context, secretIds ...string) error {
+	pending := slices.Clone(secretIds)
+	errs := make(map[string]error)
+
+	for {
+		var delay time.Duration
+		pending = slices.DeleteFunc(pending, func(secretId string) bool {
+			retryDelay, err := c.getCachedSecret(secretId).warm(ctx)
+			if err == nil {
+				delete(errs, secretId)
+				return true
+			}
+
+			if !isCallerCancellation(ctx, err) {
+				errs[secretId] = err
+			}
+
+			if delay == 0 || retryDelay < delay {
+				delay = retryDelay
+			}
+			return false
+		})
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return &NotReadyError{
+				baseError: baseError{
+					Message: fmt.Sprintf("%d secrets not ready: %s", len(pending), ctx.Err()),
+				},
+				Errors: errs,
+				Err:    ctx.Err(),
+			}
+		case <-c.clock().After(delay):
+		}
+	}
+}
+
+// warm looks up the secret for the configured version stage, fetching it if needed.
+// Returns the lookup error and, if it failed, how long to wait before looking it up again.
+func (ci *secretCacheItem) warm(ctx context.Context) (time.Duration, error) {
+	if _, err := ci.getSecretValue(ctx, ""); err != nil {
+		ci.mux.Lock()
+		defer ci.unlock()
+
+		retryDelay := time.Duration(ci.nextRetryTime - ci.config.clock().Now().UnixNano())
+		return max(retryDelay, minReadyRetryDelay), err
+	}
+
+	return 0, nil
+}
+
+// healthView is the JSON form of Health served by HealthHandler.
+type healthView struct {
+	Status           string            `json:"status"`
+	CircuitState     string            `json:"circuitState"`
+	UnhealthyRegions []string          `json:"unhealthyRegions,omitempty"`
+	FailingSecrets   map[string]string `json:"failingSecrets,omitempty"`
+	Entries          int               `json:"entries"`
+	StaleEntries     int               `json:"staleEntries"`
+	BusyEntries      int               `json:"busyEntries"`
+}
+
+// HealthHandler returns an http.Handler for readiness probes that serves Health
+// as JSON, with status 503 when the cache is unhealthy and 200 otherwise.  Do not
+// use it for liveness probes: an outage of AWS Secrets Manager would restart
+// every pod, discarding caches that were still serving; use LiveHandler instead.
+// The report names the failing secrets, so serve it only where they may be seen.
+func (c *Cache) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health, err := c.Health(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		view := healthView{
+			Status:           health.Status.String(),
+			CircuitState:     health.CircuitState.String(),
+			UnhealthyRegions: health.UnhealthyRegions,
+			FailingSecrets:   errorStrings(health.FailingSecrets),
+			Entries:          health.Entries,
+			StaleEntries:     health.StaleEntries,
+			BusyEntries:      health.BusyEntries,
+		}
+
+		status := http.StatusOK
+		if health.Status == HealthUnhealthy {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeHealthJSON(w, status, view)
+	})
+}
+
+// LiveHandler returns an http.Handler for liveness probes that answers 200 until
+// the cache is closed and 503 afterwards.  It never depends on reaching AWS
+// Secrets Manager.
+func (c *Cache) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-c.closed:
+			writeHealthJSON(w, http.StatusServiceUnavailable, liveView{Live: false})
+		default:
+			writeHealthJSON(w, http.StatusOK, liveView{Live: true})
+		}
+	})
+}
+
+// liveView is the JSON form of the liveness served by LiveHandler.
+type liveView struct {
+	Live bool `json:"live"`
+}
+
+// readyView is the JSON form of the readiness served by ReadyHandler.
+type readyView struct {
+	Ready    bool              `json:"ready"`
+	NotReady map[string]string `json:"notReady,omitempty"`
+}
+
+// ReadyHandler returns an http.Handler for readiness probes that looks up each
+// of the given secrets once per request, like a single round of WaitReady,
+// answering 200 when all of them were fetched and 503 otherwise.  Once they
+// all were, it answers 200 without further lookups.
+func (c *Cache) ReadyHandler(secretIds ...string) http.Handler {
+	var ready atomic.Bool
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ready.Load() {
+			writeHealthJSON(w, http.StatusOK, readyView{Ready: true})
+			return
+		}
+
+		errs := make(map[string]error)
+		for _, secretId := range secretIds {
+			if _, err := c.getCachedSecret(secretId).warm(r.Context()); err != nil {
+				errs[secretId] = err
+			}
+		}
+
+		if len(errs) > 0 {
+			writeHealthJSON(w, http.StatusServiceUnavailable, readyView{NotReady: errorStrings(errs)})
+			return
+		}
+
+		ready.Store(true)
+		writeHealthJSON(w, http.StatusOK, readyView{Ready: true})
+	})
+}
+
+// errorStrings returns the messages of the given errors.
+func errorStrings(errs map[string]error) map[string]string {
+	messages := make(map[string]string, len(errs))
+	for key, err := range errs {
+		messages[key] = err.Error()
+	}
+
+	return messages
+}
+
+// writeHealthJSON writes v as the JSON body of a response with the given status.
+func writeHealthJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,340 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+// A mock Client whose first DescribeSecret calls fail
+type flakyClient struct {
+	mockSecretsManagerClient
+	failures int
+}
+
+func (f *flakyClient) DescribeSecret(ctx context.Context, input *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	if f.failures > 0 {
+		f.failures--
+		f.DescribeSecretCallCount++
+		return nil, errors.New("service unavailable")
+	}
+
+	return f.mockSecretsManagerClient.DescribeSecret(ctx, input, optFns...)
+}
+
+func checkHealth(t *testing.T, secretCache *secretcache.Cache) secretcache.Health {
+	health, err := secretCache.Health(context.Background())
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	return health
+}
+
+func TestHealthOK(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	_, _ = secretCache.GetSecretString(secretId)
+	health := checkHealth(t, secretCache)
+
+	if health.Status != secretcache.HealthOK || health.Entries != 1 || len(health.FailingSecrets) != 0 {
+		t.Fatalf("Expected a healthy cache, got %+v", health)
+	}
+}
+
+func TestHealthFailingSecrets(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithTTL(time.Minute),
+	)
+
+	_, _ = secretCache.GetSecretString("stale")
+	mockClient.DescribeSecretErr = errors.New("describe failed")
+	clock.Advance(time.Minute)
+	_, _ = secretCache.GetSecretString("stale")
+	_, _ = secretCache.GetSecretString("missing")
+
+	health := checkHealth(t, secretCache)
+
+	if health.Status != secretcache.HealthDegraded || health.Entries != 2 || health.StaleEntries != 1 {
+		t.Fatalf("Expected a degraded cache with 1 stale entry, got %+v", health)
+	}
+
+	if len(health.FailingSecrets) != 2 || health.FailingSecrets["missing"] != mockClient.DescribeSecretErr {
+		t.Fatalf("Expected both secrets to be failing, got %v", health.FailingSecrets)
+	}
+
+	// With nothing left to serve, the cache is unhealthy.
+	secretCache.Invalidate("stale")
+	health = checkHealth(t, secretCache)
+
+	if health.Status != secretcache.HealthUnhealthy || health.Entries != 1 {
+		t.Fatalf("Expected an unhealthy cache, got %+v", health)
+	}
+}
+
+func TestHealthFailingValues(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.GetSecretValueErr = errors.New("access denied")
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	_, _ = secretCache.GetSecretString(secretId)
+	health := checkHealth(t, secretCache)
+
+	if health.Status != secretcache.HealthUnhealthy || health.StaleEntries != 0 {
+		t.Fatalf("Expected an unhealthy cache, got %+v", health)
+	}
+
+	if health.FailingSecrets[secretId] != mockClient.GetSecretValueErr {
+		t.Fatalf("Expected the failed value refresh, got %v", health.FailingSecrets)
+	}
+}
+
+func TestHealthCircuitOpen(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache := newCircuitBreakerCache(&mockClient, clock)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	mockClient.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	tripCircuit(secretCache)
+
+	health := checkHealth(t, secretCache)
+
+	if health.Status != secretcache.HealthUnhealthy || health.CircuitState != secretcache.CircuitOpen {
+		t.Fatalf("Expected an unhealthy cache with an open circuit, got %+v", health)
+	}
+}
+
+func TestHealthUnhealthyRegions(t *testing.T) {
+	clock := secretcachetest.NewFakeClock(time.Now())
+	primary := newMockedRegionalClient()
+	primary.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	client := secretcache.NewFailoverClient(
+		secretcache.RegionalClient{Region: "us-east-1", Client: primary},
+		secretcache.RegionalClient{Region: "us-west-2", Client: newMockedRegionalClient()},
+	)
+	client.Clock = clock
+	secretCache, _ := secretcache.New(secretcache.WithClient(client), secretcache.WithClock(clock))
+
+	_, _ = secretCache.GetSecretString("dummy-secret-name")
+	health := checkHealth(t, secretCache)
+
+	if health.Status != secretcache.HealthDegraded || len(health.UnhealthyRegions) != 1 || health.UnhealthyRegions[0] != "us-east-1" {
+		t.Fatalf("Expected a degraded cache with us-east-1 unhealthy, got %+v", health)
+	}
+}
+
+func TestHealthContextDone(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+	_, _ = secretCache.GetSecretString(secretId)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := secretCache.Health(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestHealthBusy(t *testing.T) {
+	client := newBlockingClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+	)
+	defer close(client.release)
+
+	go func() { _, _ = secretCache.GetSecretString("busy") }()
+	waitFor(t, func() bool { return client.calls.Load() == 1 })
+
+	type result struct {
+		health secretcache.Health
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		health, err := secretCache.Health(context.Background())
+		done <- result{health, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil || r.health.Status != secretcache.HealthOK || r.health.Entries != 1 || r.health.BusyEntries != 1 {
+			t.Fatalf("Expected an ok cache with a busy entry, got %+v and %v", r.health, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected Health not to wait for the lookup")
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	if err := secretCache.WaitReady(context.Background(), "first", "second"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if mockClient.DescribeSecretCallCount != 2 || mockClient.GetSecretValueCallCount != 2 {
+		t.Fatalf("Expected both secrets to be fetched, got %d and %d calls", mockClient.DescribeSecretCallCount, mockClient.GetSecretValueCallCount)
+	}
+
+	// Ready secrets are served from the cache.
+	if err := secretCache.WaitReady(context.Background(), "first"); err != nil || mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected no more calls, got %v and %d calls", err, mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestWaitReadyRetries(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	client := &flakyClient{mockSecretsManagerClient: mockClient, failures: 2}
+	secretCache, _ := secretcache.New(secretcache.WithClient(client))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := secretCache.WaitReady(ctx, secretId); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if client.DescribeSecretCallCount != 3 {
+		t.Fatalf("Expected 3 calls, got %d", client.DescribeSecretCallCount)
+	}
+}
+
+func TestWaitReadyContextDone(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = errors.New("describe failed")
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(secretcachetest.NewFakeClock(time.Now())),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := secretCache.WaitReady(ctx, "failing")
+
+	var notReadyErr *secretcache.NotReadyError
+	if !errors.As(err, &notReadyErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected NotReadyError wrapping context.DeadlineExceeded, got %v", err)
+	}
+
+	if notReadyErr.Errors["failing"] != mockClient.DescribeSecretErr {
+		t.Fatalf("Expected the lookup error, got %v", notReadyErr.Errors)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache := newCircuitBreakerCache(&mockClient, clock)
+	handler := secretCache.HealthHandler()
+
+	_, _ = secretCache.GetSecretString(secretId)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var body map[string]interface{}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+
+	if recorder.Code != http.StatusOK || body["status"] != "ok" || body["entries"] != 1.0 {
+		t.Fatalf("Expected 200 and ok, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	mockClient.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	tripCircuit(secretCache)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+
+	if recorder.Code != http.StatusServiceUnavailable || body["status"] != "unhealthy" || body["circuitState"] != "open" {
+		t.Fatalf("Expected 503 and unhealthy, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = errors.New("describe failed")
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient), secretcache.WithClock(clock))
+	handler := secretCache.ReadyHandler(secretId)
+
+	probe := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return recorder
+	}
+
+	if recorder := probe(); recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	mockClient.DescribeSecretErr = nil
+	clock.Advance(time.Hour)
+
+	if recorder := probe(); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Once ready, later failures do not take the pod out of rotation.
+	calls := mockClient.DescribeSecretCallCount
+	secretCache.InvalidateAll()
+	mockClient.DescribeSecretErr = errors.New("describe failed")
+
+	if recorder := probe(); recorder.Code != http.StatusOK || mockClient.DescribeSecretCallCount != calls {
+		t.Fatalf("Expected 200 without lookups, got %d after %d calls", recorder.Code, mockClient.DescribeSecretCallCount-calls)
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = newServerError(http.StatusServiceUnavailable)
+	secretCache := newCircuitBreakerCache(&mockClient, secretcachetest.NewFakeClock(time.Now()))
+	handler := secretCache.LiveHandler()
+
+	// An unreachable AWS Secrets Manager does not make the cache dead.
+	tripCircuit(secretCache)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	_ = secretCache.Close()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 once closed, got %d", recorder.Code)
+	}
+}
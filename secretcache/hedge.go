@@ -0,0 +1,131 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// hedgingClient sends a second GetSecretValue, DescribeSecret or
+// BatchGetSecretValue call when the first has not answered within the hedge
+// delay.  Other calls go to the wrapped client unchanged.
+type hedgingClient struct {
+	SecretsManagerAPIClient
+	hedge SecretsManagerAPIClient
+
+	// The region of the hedge client, for which secret ARNs are rewritten, if known.
+	hedgeRegion string
+	delay       time.Duration
+	clock       Clock
+	stats       *cacheStats
+}
+
+// newHedgingClient wraps client, hedging to hedge with the delay of config.
+func newHedgingClient(client SecretsManagerAPIClient, hedge SecretsManagerAPIClient, config CacheConfig, stats *cacheStats) *hedgingClient {
+	return &hedgingClient{
+		SecretsManagerAPIClient: client,
+		hedge:                   hedge,
+		hedgeRegion:             clientRegion(config.HedgeClient),
+		delay:                   config.HedgeDelay,
+		clock:                   config.clock(),
+		stats:                   stats,
+	}
+}
+
+func (h *hedgingClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return hedged(h, ctx, func(ctx context.Context, client SecretsManagerAPIClient, region string) (*secretsmanager.GetSecretValueOutput, error) {
+		input := *params
+		input.SecretId = regionalSecretId(params.SecretId, region)
+		return client.GetSecretValue(ctx, &input, optFns...)
+	})
+}
+
+func (h *hedgingClient) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	return hedged(h, ctx, func(ctx context.Context, client SecretsManagerAPIClient, region string) (*secretsmanager.DescribeSecretOutput, error) {
+		input := *params
+		input.SecretId = regionalSecretId(params.SecretId, region)
+		return client.DescribeSecret(ctx, &input, optFns...)
+	})
+}
+
+func (h *hedgingClient) BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	return hedged(h, ctx, func(ctx context.Context, client SecretsManagerAPIClient, region string) (*secretsmanager.BatchGetSecretValueOutput, error) {
+		input := *params
+		input.SecretIdList = make([]string, len(params.SecretIdList))
+		for i := range params.SecretIdList {
+			input.SecretIdList[i] = *regionalSecretId(&params.SecretIdList[i], region)
+		}
+
+		return callBatchGetSecretValue(ctx, client, &input, optFns...)
+	})
+}
+
+// hedgedResponse is the result of one of the calls of a hedged request.
+type hedgedResponse[T any] struct {
+	output T
+	err    error
+}
+
+// hedged calls the primary client and, if it has not answered within the hedge
+// delay, the hedge client too.  call is given the client and the region it
+// serves, or an empty string if that is not known.  The first successful
+// response wins and the other call is cancelled through its context.  If the
+// first call to answer fails, the other call is waited for.
+// Returns an error if every call made failed.
+func hedged[T any](h *hedgingClient, ctx context.Context, call func(context.Context, SecretsManagerAPIClient, string) (T, error)) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered so that the losing call never blocks once hedged returns.
+	responses := make(chan hedgedResponse[T], 2)
+	send := func(client SecretsManagerAPIClient, region string) {
+		go func() {
+			output, err := call(ctx, client, region)
+			responses <- hedgedResponse[T]{output, err}
+		}()
+	}
+
+	send(h.SecretsManagerAPIClient, "")
+
+	select {
+	case response := <-responses:
+		return response.output, response.err
+	case <-h.clock.After(h.delay):
+	}
+
+	h.stats.add(statHedgedRequests)
+	send(h.hedge, h.hedgeRegion)
+
+	response := <-responses
+	if response.err != nil {
+		if other := <-responses; other.err == nil {
+			return other.output, nil
+		}
+	}
+
+	return response.output, response.err
+}
+
+// clientRegion returns the region of an AWS SDK client, or an empty string for
+// other clients.
+func clientRegion(client SecretsManagerAPIClient) string {
+	if regional, ok := client.(interface{ Options() secretsmanager.Options }); ok {
+		return regional.Options().Region
+	}
+
+	return ""
+}
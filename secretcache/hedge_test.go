@@ -0,0 +1,209 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+// A mock Client whose GetSecretValue calls block until released or cancelled
+type blockingClient struct {
+	mockSecretsManagerClient
+	release   chan struct{}
+	err       error
+	calls     atomic.Int32
+	cancelled atomic.Int32
+}
+
+func newBlockingClient() *blockingClient {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	return &blockingClient{mockSecretsManagerClient: mockClient, release: make(chan struct{})}
+}
+
+func (m *blockingClient) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.calls.Add(1)
+
+	select {
+	case <-ctx.Done():
+		m.cancelled.Add(1)
+		return nil, ctx.Err()
+	case <-m.release:
+	}
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return m.MockedGetResult, nil
+}
+
+// getSecretStringHedged looks up secretId in the background, advancing clock
+// past the hedge delay once the lookup waits for it.
+func getSecretStringHedged(t *testing.T, secretCache *secretcache.Cache, clock *secretcachetest.FakeClock, secretId string) (string, error) {
+	type result struct {
+		value string
+		err   error
+	}
+	done := make(chan result)
+
+	go func() {
+		value, err := secretCache.GetSecretString(secretId)
+		done <- result{value, err}
+	}()
+
+	waitFor(t, func() bool { return clock.Waiters() > 0 })
+	clock.Advance(secretCache.HedgeDelay)
+
+	r := <-done
+	return r.value, r.err
+}
+
+func TestHedgedRequestWins(t *testing.T) {
+	primary := newBlockingClient()
+	hedge, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(primary),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithHedging(50*time.Millisecond, &hedge),
+	)
+
+	value, err := getSecretStringHedged(t, secretCache, clock, secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	if hedged := secretCache.Stats().HedgedRequests; hedged != 1 {
+		t.Fatalf("Expected 1 hedged request, got %d", hedged)
+	}
+
+	// The losing call is cancelled.
+	waitFor(t, func() bool { return primary.cancelled.Load() == 1 })
+}
+
+func TestHedgedRequestPrimaryAnswersFirst(t *testing.T) {
+	primary := newBlockingClient()
+	close(primary.release)
+	hedge, secretId, _ := newMockedClientWithDummyResults()
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(primary),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithHedging(time.Hour, &hedge),
+	)
+
+	if _, err := secretCache.GetSecretString(secretId); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if hedge.GetSecretValueCallCount != 0 {
+		t.Fatalf("Expected no hedged calls, got %d", hedge.GetSecretValueCallCount)
+	}
+
+	if hedged := secretCache.Stats().HedgedRequests; hedged != 0 {
+		t.Fatalf("Expected no hedged requests, got %d", hedged)
+	}
+}
+
+func TestHedgedRequestFirstResponseFails(t *testing.T) {
+	primary := newBlockingClient()
+	primary.err = errors.New("primary failed")
+	hedge := newBlockingClient()
+	_, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(primary),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithHedging(50*time.Millisecond, hedge),
+	)
+
+	done := make(chan error)
+	go func() {
+		_, err := secretCache.GetSecretString(secretId)
+		done <- err
+	}()
+
+	waitFor(t, func() bool { return clock.Waiters() > 0 })
+	clock.Advance(50 * time.Millisecond)
+	waitFor(t, func() bool { return hedge.calls.Load() == 1 })
+
+	// The primary answers first with an error; the hedged call still wins.
+	close(primary.release)
+	time.Sleep(10 * time.Millisecond)
+	close(hedge.release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if value, _ := secretCache.GetSecretString(secretId); value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+}
+
+// A mock Client reporting the region of an AWS SDK client
+type regionalMockClient struct {
+	mockSecretsManagerClient
+	region string
+}
+
+func (m *regionalMockClient) Options() secretsmanager.Options {
+	return secretsmanager.Options{Region: m.region}
+}
+
+func TestHedgedRequestRewritesSecretArn(t *testing.T) {
+	primary := newBlockingClient()
+	mockClient, _, secretString := newMockedClientWithDummyResults()
+	hedge := &regionalMockClient{mockSecretsManagerClient: mockClient, region: "us-west-2"}
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(primary),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithHedging(50*time.Millisecond, hedge),
+	)
+
+	value, err := getSecretStringHedged(t, secretCache, clock, "arn:aws:secretsmanager:us-east-1:123456789012:secret:name")
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	expected := "arn:aws:secretsmanager:us-west-2:123456789012:secret:name"
+	if secretId := *hedge.GetSecretValueInputs[0].SecretId; secretId != expected {
+		t.Fatalf("Expected the hedged call for %s, got %s", expected, secretId)
+	}
+}
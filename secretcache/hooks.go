@@ -0,0 +1,186 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// ChainHooks returns a CacheHookV2 applying hooks in turn.  Put calls them
+// first to last, each receiving the output of the previous one, and Get calls
+// them last to first, so that each hook's Get sees what its own Put returned.
+// For example ChainHooks(audit, encrypt) audits plaintext and caches it encrypted.
+// The chain stops at the first hook that fails.
+//
+// The chain implements CacheHookWiper by passing the cached data, the output of
+// the last hook, to that hook if it implements CacheHookWiper.  What earlier
+// hooks returned is not kept by the cache, so is not wiped; put a hook that
+// wipes what it returns last.
+func ChainHooks(hooks ...CacheHookV2) CacheHookV2 {
+	return hookChain(slices.Clone(hooks))
+}
+
+// hookChain is the CacheHookV2 returned by ChainHooks.
+type hookChain []CacheHookV2
+
+func (c hookChain) Put(ctx context.Context, info HookInfo, data interface{}) (interface{}, error) {
+	for _, hook := range c {
+		var err error
+		if data, err = hook.Put(ctx, info, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (c hookChain) Get(ctx context.Context, info HookInfo, data interface{}) (interface{}, error) {
+	for i := len(c) - 1; i >= 0; i-- {
+		var err error
+		if data, err = c[i].Get(ctx, info, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (c hookChain) Wipe(data interface{}) {
+	if len(c) == 0 {
+		return
+	}
+
+	if wiper, ok := c[len(c)-1].(CacheHookWiper); ok {
+		wiper.Wipe(data)
+	}
+}
+
+// CopyOnGetHook returns a copy of each cached object from Get, so that callers
+// modifying a returned value, such as the bytes of SecretBinary, do not change
+// the cached one.  Put stores objects unchanged.
+type CopyOnGetHook struct{}
+
+func (CopyOnGetHook) Put(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	return data, nil
+}
+
+func (CopyOnGetHook) Get(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case *secretsmanager.GetSecretValueOutput:
+		copied := *value
+		copied.SecretBinary = slices.Clone(value.SecretBinary)
+		copied.VersionStages = slices.Clone(value.VersionStages)
+		return &copied, nil
+	case *secretsmanager.DescribeSecretOutput:
+		copied := *value
+		copied.VersionIdsToStages = maps.Clone(value.VersionIdsToStages)
+		for versionId, stages := range copied.VersionIdsToStages {
+			copied.VersionIdsToStages[versionId] = slices.Clone(stages)
+		}
+		return &copied, nil
+	default:
+		return data, nil
+	}
+}
+
+// ErrSecretTooLarge is matched by errors.Is for the errors of a SizeLimitHook.
+var ErrSecretTooLarge = errors.New("secret value exceeds the size limit")
+
+// SizeLimitHook refuses to cache secret values larger than MaxBytes, counting
+// both SecretString and SecretBinary.  Descriptions are not limited.
+type SizeLimitHook struct {
+	MaxBytes int
+}
+
+func (h SizeLimitHook) Put(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	if size := secretValueSize(data); size > h.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrSecretTooLarge, size, h.MaxBytes)
+	}
+
+	return data, nil
+}
+
+func (SizeLimitHook) Get(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	return data, nil
+}
+
+// MetricsHook counts the objects passing through it.  It stores objects
+// unchanged and is safe for concurrent use.
+type MetricsHook struct {
+	puts       [2]atomic.Uint64
+	gets       [2]atomic.Uint64
+	valueBytes atomic.Uint64
+}
+
+// HookMetrics is a snapshot of the counters of a MetricsHook.
+type HookMetrics struct {
+	// The number of secret descriptions and secret values stored.
+	DescriptionPuts, ValuePuts uint64
+
+	// The number of secret descriptions and secret values read.
+	DescriptionGets, ValueGets uint64
+
+	// The total size of the secret values stored.
+	ValueBytes uint64
+}
+
+func (h *MetricsHook) Put(_ context.Context, info HookInfo, data interface{}) (interface{}, error) {
+	if info.Kind == HookKindDescription || info.Kind == HookKindValue {
+		h.puts[info.Kind].Add(1)
+	}
+
+	h.valueBytes.Add(uint64(secretValueSize(data)))
+	return data, nil
+}
+
+func (h *MetricsHook) Get(_ context.Context, info HookInfo, data interface{}) (interface{}, error) {
+	if info.Kind == HookKindDescription || info.Kind == HookKindValue {
+		h.gets[info.Kind].Add(1)
+	}
+
+	return data, nil
+}
+
+// Metrics returns a snapshot of the hook's counters.
+func (h *MetricsHook) Metrics() HookMetrics {
+	return HookMetrics{
+		DescriptionPuts: h.puts[HookKindDescription].Load(),
+		ValuePuts:       h.puts[HookKindValue].Load(),
+		DescriptionGets: h.gets[HookKindDescription].Load(),
+		ValueGets:       h.gets[HookKindValue].Load(),
+		ValueBytes:      h.valueBytes.Load(),
+	}
+}
+
+// secretValueSize returns the size of the secret held by data, or zero if data is not a secret value.
+func secretValueSize(data interface{}) int {
+	value, ok := data.(*secretsmanager.GetSecretValueOutput)
+	if !ok || value == nil {
+		return 0
+	}
+
+	size := len(value.SecretBinary)
+	if value.SecretString != nil {
+		size += len(*value.SecretString)
+	}
+
+	return size
+}
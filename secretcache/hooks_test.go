@@ -0,0 +1,203 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// A hook recording the order of its calls in a shared log and tagging the
+// values it stores
+type orderHook struct {
+	name   string
+	log    *[]string
+	wiped  int
+	putErr error
+}
+
+type taggedValue struct {
+	tag   string
+	value interface{}
+}
+
+func (h *orderHook) Put(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	*h.log = append(*h.log, "put "+h.name)
+	if h.putErr != nil {
+		return nil, h.putErr
+	}
+
+	return taggedValue{tag: h.name, value: data}, nil
+}
+
+func (h *orderHook) Get(_ context.Context, _ HookInfo, data interface{}) (interface{}, error) {
+	*h.log = append(*h.log, "get "+h.name)
+	tagged, ok := data.(taggedValue)
+	if !ok || tagged.tag != h.name {
+		return nil, errors.New("hook " + h.name + " got a value it did not store")
+	}
+
+	return tagged.value, nil
+}
+
+func (h *orderHook) Wipe(data interface{}) {
+	if tagged, ok := data.(taggedValue); ok && tagged.tag == h.name {
+		h.wiped++
+	}
+}
+
+func newHookedVersion(hook CacheHookV2) cacheVersion {
+	return newCacheVersion(CacheConfig{HookV2: hook}, &dummyClient{}, &cacheStats{}, "dummy-secret-name", "dummy-version")
+}
+
+func newSecretValue(secret string) *secretsmanager.GetSecretValueOutput {
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString:  getStrPtr(secret),
+		SecretBinary:  []byte(secret),
+		VersionStages: []string{"AWSCURRENT"},
+	}
+}
+
+func TestChainHooksOrder(t *testing.T) {
+	var log []string
+	first, second := &orderHook{name: "first", log: &log}, &orderHook{name: "second", log: &log}
+	cv := newHookedVersion(ChainHooks(first, second))
+	ctx := context.Background()
+
+	if err := cv.setWithHook(ctx, newSecretValue("secret")); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	result, err := cv.getWithHook(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if *result.SecretString != "secret" {
+		t.Fatalf("Expected secret, got %s", *result.SecretString)
+	}
+
+	expected := []string{"put first", "put second", "get second", "get first"}
+	if !slices.Equal(log, expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, log)
+	}
+
+	cv.wipe()
+
+	if first.wiped != 0 || second.wiped != 1 {
+		t.Fatalf("Expected only the last hook to wipe the data it returned, got %d and %d", first.wiped, second.wiped)
+	}
+}
+
+func TestChainHooksPutError(t *testing.T) {
+	var log []string
+	putErr := errors.New("put failed")
+	first := &orderHook{name: "first", log: &log, putErr: putErr}
+	second := &orderHook{name: "second", log: &log}
+	cv := newHookedVersion(ChainHooks(first, second))
+
+	err := cv.setWithHook(context.Background(), newSecretValue("secret"))
+
+	if !errors.Is(err, putErr) {
+		t.Fatalf("Expected the put error, got %v", err)
+	}
+
+	if expected := []string{"put first"}; !slices.Equal(log, expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, log)
+	}
+
+	if cv.data != nil {
+		t.Fatalf("Expected no data to be stored")
+	}
+}
+
+func TestCopyOnGetHook(t *testing.T) {
+	cv := newHookedVersion(ChainHooks(CopyOnGetHook{}))
+	ctx := context.Background()
+	_ = cv.setWithHook(ctx, newSecretValue("secret"))
+
+	first, _ := cv.getWithHook(ctx)
+	first.SecretBinary[0] = 'X'
+	first.VersionStages[0] = "AWSPREVIOUS"
+
+	second, _ := cv.getWithHook(ctx)
+
+	if string(second.SecretBinary) != "secret" {
+		t.Fatalf("Expected the cached binary to be unchanged, got %s", second.SecretBinary)
+	}
+
+	if second.VersionStages[0] != "AWSCURRENT" {
+		t.Fatalf("Expected the cached stages to be unchanged, got %v", second.VersionStages)
+	}
+}
+
+func TestCopyOnGetHookDescription(t *testing.T) {
+	desc := &secretsmanager.DescribeSecretOutput{
+		VersionIdsToStages: map[string][]string{"v1": {"AWSCURRENT"}},
+	}
+
+	data, _ := CopyOnGetHook{}.Get(context.Background(), HookInfo{Kind: HookKindDescription}, desc)
+	copied := data.(*secretsmanager.DescribeSecretOutput)
+	copied.VersionIdsToStages["v1"][0] = "AWSPREVIOUS"
+	copied.VersionIdsToStages["v2"] = []string{"AWSPENDING"}
+
+	if len(desc.VersionIdsToStages) != 1 || desc.VersionIdsToStages["v1"][0] != "AWSCURRENT" {
+		t.Fatalf("Expected the cached description to be unchanged, got %v", desc.VersionIdsToStages)
+	}
+}
+
+func TestSizeLimitHook(t *testing.T) {
+	cv := newHookedVersion(SizeLimitHook{MaxBytes: 12})
+	ctx := context.Background()
+
+	if err := cv.setWithHook(ctx, newSecretValue("small")); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	err := cv.setWithHook(ctx, newSecretValue("much too large"))
+
+	if !errors.Is(err, ErrSecretTooLarge) {
+		t.Fatalf("Expected ErrSecretTooLarge, got %v", err)
+	}
+
+	var hookErr *HookError
+	if !errors.As(err, &hookErr) || hookErr.Kind != HookKindValue {
+		t.Fatalf("Expected a *HookError for a value, got %v", err)
+	}
+
+	result, _ := cv.getWithHook(ctx)
+	if *result.SecretString != "small" {
+		t.Fatalf("Expected the previous value to be kept, got %s", *result.SecretString)
+	}
+}
+
+func TestMetricsHook(t *testing.T) {
+	metrics := &MetricsHook{}
+	cv := newHookedVersion(ChainHooks(metrics, CopyOnGetHook{}))
+	ctx := context.Background()
+
+	_ = cv.setWithHook(ctx, newSecretValue("secret"))
+	for i := 0; i < 3; i++ {
+		_, _ = cv.getWithHook(ctx)
+	}
+
+	expected := HookMetrics{ValuePuts: 1, ValueGets: 3, ValueBytes: 12}
+	if got := metrics.Metrics(); got != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, got)
+	}
+}
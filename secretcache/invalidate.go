@@ -0,0 +1,54 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+// Invalidate drops the cached secret with the given id, without calling AWS
+// Secrets Manager.  Its data is wiped through the hook and reported to
+// OnEvict with EvictedInvalidated, and the next lookup fetches it again.
+// Invalidate does not wait for lookups of the secret already in progress: they
+// finish with the value they found, and the secret is wiped and reported to
+// OnEvict when they do.
+// Returns true if the secret was cached.
+func (c *Cache) Invalidate(secretId string) bool {
+	data, found := c.lru.remove(secretId)
+	if found {
+		data.(*secretCacheItem).evict(EvictedInvalidated)
+	}
+
+	return found
+}
+
+// InvalidateAll drops every cached secret, like Invalidate.
+// Returns the number of secrets dropped.
+func (c *Cache) InvalidateAll() int {
+	return c.evictAll(c.lru.removeAll(), EvictedInvalidated)
+}
+
+// InvalidateMatching drops the cached secrets whose id matches, like
+// Invalidate.  match is called with the cache locked, so must not call back
+// into the cache.
+// Returns the number of secrets dropped.
+func (c *Cache) InvalidateMatching(match func(secretId string) bool) int {
+	return c.evictAll(c.lru.removeMatching(match), EvictedInvalidated)
+}
+
+// evictAll evicts secret cache items removed from the cache for the given reason.
+// Returns the number of items.
+func (c *Cache) evictAll(items []interface{}, reason EvictionReason) int {
+	for _, data := range items {
+		data.(*secretCacheItem).evict(reason)
+	}
+
+	return len(items)
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+)
+
+func TestInvalidate(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	recorder := &lifecycleRecorder{}
+	hook := &WipingCacheHook{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHook(hook),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if !secretCache.Invalidate(secretId) {
+		t.Fatalf("Expected the cached secret to be invalidated")
+	}
+
+	if mockClient.DescribeSecretCallCount != 1 || mockClient.GetSecretValueCallCount != 1 {
+		t.Fatalf("Expected no calls while invalidating")
+	}
+
+	if len(hook.wiped) != 2 {
+		t.Fatalf("Expected the cached value and description to be wiped, got %d", len(hook.wiped))
+	}
+
+	expected := []string{
+		"evict value dummy-secret-name/very-random-uuid invalidated",
+		"evict description dummy-secret-name invalidated",
+	}
+	if evictions := recorder.evictions(); !slices.Equal(evictions, expected) {
+		t.Fatalf("Expected evictions %v, got %v", expected, evictions)
+	}
+
+	if secretCache.Invalidate(secretId) {
+		t.Fatalf("Did not expect to invalidate the secret twice")
+	}
+
+	if value, _ := secretCache.GetSecretString(secretId); value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected the secret to be fetched again, got %d calls", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestInvalidateMatching(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	for _, secretId := range []string{"tenant/a", "tenant/b", "shared/c"} {
+		_, _ = secretCache.GetSecretString(secretId)
+	}
+
+	dropped := secretCache.InvalidateMatching(func(secretId string) bool {
+		return strings.HasPrefix(secretId, "tenant/")
+	})
+
+	if dropped != 2 {
+		t.Fatalf("Expected 2 secrets dropped, got %d", dropped)
+	}
+
+	if secretCache.Invalidate("tenant/a") || !secretCache.Invalidate("shared/c") {
+		t.Fatalf("Expected only the matching secrets to be dropped")
+	}
+}
+
+func TestInvalidateAll(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	for _, secretId := range []string{"a", "b", "c"} {
+		_, _ = secretCache.GetSecretString(secretId)
+	}
+
+	if dropped := secretCache.InvalidateAll(); dropped != 3 {
+		t.Fatalf("Expected 3 secrets dropped, got %d", dropped)
+	}
+
+	if dropped := secretCache.InvalidateAll(); dropped != 0 {
+		t.Fatalf("Expected an empty cache, got %d secrets dropped", dropped)
+	}
+
+	_, _ = secretCache.GetSecretString("a")
+	if mockClient.DescribeSecretCallCount != 4 {
+		t.Fatalf("Expected the secret to be fetched again, got %d calls", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestInvalidateConcurrentLookups(t *testing.T) {
+	client := newGatedClient()
+	close(client.release)
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				value, err := secretCache.GetSecretString("dummy-secret-name")
+				if err != nil || value != "my secret string" {
+					t.Errorf("Expected my secret string, got %q and %v", value, err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		secretCache.Invalidate("dummy-secret-name")
+	}
+	wg.Wait()
+}
+
+func TestInvalidateDuringLookup(t *testing.T) {
+	drops := map[string]struct {
+		drop   func(*secretcache.Cache)
+		reason string
+	}{
+		"Invalidate":    {func(c *secretcache.Cache) { c.Invalidate("dummy-secret-name") }, "invalidated"},
+		"InvalidateAll": {func(c *secretcache.Cache) { c.InvalidateAll() }, "invalidated"},
+		"Close":         {func(c *secretcache.Cache) { _ = c.Close() }, "closed"},
+	}
+
+	for name, tc := range drops {
+		t.Run(name, func(t *testing.T) {
+			client := newBlockingClient()
+			recorder := &lifecycleRecorder{}
+			secretCache, _ := secretcache.New(
+				secretcache.WithClient(client),
+				secretcache.WithDirectStageLookup(true),
+				secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+			)
+
+			lookup := make(chan error, 1)
+			go func() {
+				_, err := secretCache.GetSecretString("dummy-secret-name")
+				lookup <- err
+			}()
+			waitFor(t, func() bool { return client.calls.Load() == 1 })
+
+			dropped := make(chan struct{})
+			go func() {
+				tc.drop(secretCache)
+				close(dropped)
+			}()
+			select {
+			case <-dropped:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected %s not to wait for the lookup", name)
+			}
+
+			close(client.release)
+			if err := <-lookup; err != nil {
+				t.Fatalf("Unexpected error - %s", err.Error())
+			}
+
+			expected := []string{
+				"evict value dummy-secret-name/very-random-uuid " + tc.reason,
+				"evict description dummy-secret-name " + tc.reason,
+			}
+			if evictions := recorder.evictions(); !slices.Equal(evictions, expected) {
+				t.Fatalf("Expected evictions %v, got %v", expected, evictions)
+			}
+		})
+	}
+}
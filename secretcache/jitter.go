@@ -0,0 +1,95 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// JitterStrategy spreads out refresh times so that cached items, and caches
+// running across a fleet, do not all call AWS Secrets Manager at the same
+// moment. The cache uses it for the ttl of a refreshed item and for the
+// delay before a forced refresh.
+//
+// Given the same random source and clock, a strategy must return the same
+// sequence of delays, so that a refresh schedule can be replayed.
+type JitterStrategy interface {
+	// Jitter returns the delay to use in place of base, drawing any
+	// randomness from rnd. The result should not exceed base.
+	Jitter(base time.Duration, rnd *rand.Rand) time.Duration
+}
+
+// EqualJitter keeps half of the delay and draws the other half uniformly,
+// returning a delay in [base/2, base). It is the default strategy.
+type EqualJitter struct{}
+
+func (EqualJitter) Jitter(base time.Duration, rnd *rand.Rand) time.Duration {
+	if base < 2 {
+		return base
+	}
+
+	return time.Duration(rnd.Int63n(int64(base/2))) + base/2
+}
+
+// FullJitter draws the whole delay uniformly from [0, base).
+type FullJitter struct{}
+
+func (FullJitter) Jitter(base time.Duration, rnd *rand.Rand) time.Duration {
+	if base < 1 {
+		return base
+	}
+
+	return time.Duration(rnd.Int63n(int64(base)))
+}
+
+// NoJitter always returns the base delay unchanged.
+type NoJitter struct{}
+
+func (NoJitter) Jitter(base time.Duration, _ *rand.Rand) time.Duration {
+	return base
+}
+
+// lockedSource serialises access to a rand.Source that is shared by all the
+// items of a cache.
+type lockedSource struct {
+	mux sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.src.Seed(seed)
+}
+
+// globalSource draws from the top level functions of math/rand.
+type globalSource struct{}
+
+func (globalSource) Int63() int64 {
+	return rand.Int63()
+}
+
+func (globalSource) Seed(int64) {}
+
+var globalRand = rand.New(globalSource{})
@@ -0,0 +1,156 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestJitterStrategies(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	base := time.Hour
+
+	for i := 0; i < 1000; i++ {
+		if d := (EqualJitter{}).Jitter(base, rnd); d < base/2 || d >= base {
+			t.Fatalf("Expected EqualJitter delay in [%s, %s), got %s", base/2, base, d)
+		}
+
+		if d := (FullJitter{}).Jitter(base, rnd); d < 0 || d >= base {
+			t.Fatalf("Expected FullJitter delay in [0, %s), got %s", base, d)
+		}
+
+		if d := (NoJitter{}).Jitter(base, rnd); d != base {
+			t.Fatalf("Expected NoJitter delay of %s, got %s", base, d)
+		}
+	}
+
+	if d := (EqualJitter{}).Jitter(1, rnd); d != 1 {
+		t.Fatalf("Expected EqualJitter to keep a tiny delay, got %s", d)
+	}
+}
+
+// refreshSchedule refreshes a cache item count times, moving the clock to
+// each scheduled refresh, and returns the offsets between refreshes.
+func refreshSchedule(config CacheConfig, count int) []time.Duration {
+	clock := config.Clock.(*sleepingClock)
+	cacheItem := newSecretCacheItem(config, &dummyClient{}, nil, "dummy-secret-name")
+
+	var schedule []time.Duration
+	for i := 0; i < count; i++ {
+		cacheItem.refresh(context.Background())
+		next := time.Unix(0, cacheItem.nextRefreshTime)
+		schedule = append(schedule, next.Sub(clock.now))
+		clock.now = next
+	}
+
+	return schedule
+}
+
+func TestRefreshScheduleReplay(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newConfig := func() CacheConfig {
+		return CacheConfig{
+			TTL:        time.Hour,
+			Clock:      &sleepingClock{now: start},
+			RandSource: rand.NewSource(42),
+		}
+	}
+
+	first := refreshSchedule(newConfig(), 20)
+	second := refreshSchedule(newConfig(), 20)
+
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected identical schedules for the same seed, refresh %d differs: %s, %s", i, first[i], second[i])
+		}
+	}
+
+	config := newConfig()
+	config.RandSource = rand.NewSource(43)
+	other := refreshSchedule(config, 20)
+
+	same := true
+	for i := range first {
+		same = same && first[i] == other[i]
+	}
+
+	if same {
+		t.Fatalf("Expected a different seed to give a different schedule")
+	}
+}
+
+func TestFleetRefreshSpread(t *testing.T) {
+	const fleetSize = 1000
+	const buckets = 10
+	ttl := time.Hour
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var counts [buckets]int
+	for i := 0; i < fleetSize; i++ {
+		config := CacheConfig{
+			TTL:        ttl,
+			Clock:      &sleepingClock{now: start},
+			RandSource: rand.NewSource(int64(i)),
+		}
+
+		delay := refreshSchedule(config, 1)[0]
+
+		if delay < ttl/2 || delay >= ttl {
+			t.Fatalf("Expected refresh within [%s, %s), got %s", ttl/2, ttl, delay)
+		}
+
+		counts[int((delay-ttl/2)*buckets/(ttl/2))]++
+	}
+
+	// Each bucket of the window should get close to an equal share.
+	expected := fleetSize / buckets
+	for bucket, count := range counts {
+		if count < expected*6/10 || count > expected*14/10 {
+			t.Fatalf("Expected around %d refreshes in bucket %d, got %d (%v)", expected, bucket, count, counts)
+		}
+	}
+}
+
+func TestRefreshNowWaitsForRetry(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		retryDelay time.Duration
+		sleep      time.Duration
+	}{
+		{retryDelay: 10 * time.Second, sleep: 10 * time.Second},
+		{retryDelay: time.Second, sleep: forceRefreshJitterSleep * time.Millisecond},
+	}
+
+	for _, testCase := range testCases {
+		clock := &sleepingClock{now: start}
+		config := CacheConfig{Clock: clock, Jitter: NoJitter{}}
+		cacheItem := newSecretCacheItem(config, &dummyClient{}, nil, "dummy-secret-name")
+		cacheItem.err = errors.New("refresh failed")
+		cacheItem.nextRetryTime = start.Add(testCase.retryDelay).UnixNano()
+		cacheItem.nextRefreshTime = start.Add(time.Hour).UnixNano()
+
+		cacheItem.refreshNow(context.Background())
+
+		// The forced refresh waits for the retry backoff, not the next scheduled refresh.
+		if slept := clock.now.Sub(start); slept != testCase.sleep {
+			t.Fatalf("Expected a sleep of %s for a retry in %s, got %s", testCase.sleep, testCase.retryDelay, slept)
+		}
+	}
+}
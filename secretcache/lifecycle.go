@@ -0,0 +1,124 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"fmt"
+)
+
+// EvictionReason says why an entry left the cache.
+type EvictionReason int
+
+const (
+	// EvictedCapacity entries made room for others under MaxCacheSize or
+	// MaxVersionsPerSecret.
+	EvictedCapacity EvictionReason = iota
+
+	// EvictedIdle entries were not looked up within IdleTimeout.
+	EvictedIdle
+
+	// EvictedInvalidated entries were dropped explicitly, or were versions no
+	// longer attached to any stage.
+	EvictedInvalidated
+
+	// EvictedClosed entries were dropped by Close.
+	EvictedClosed
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictedCapacity:
+		return "capacity"
+	case EvictedIdle:
+		return "idle"
+	case EvictedInvalidated:
+		return "invalidated"
+	case EvictedClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("EvictionReason(%d)", int(r))
+	}
+}
+
+// LifecycleCallbacks are told about the cache's entries: one per secret,
+// identified by a HookInfo of kind HookKindDescription, and one per cached
+// version of it, of kind HookKindValue.  Any callback may be nil.
+//
+// Callbacks run synchronously, so they must be quick.  OnRefresh, OnEvict and
+// the OnInsert of versions run while the secret is locked, so they must not
+// look up the same secret; the OnInsert of a secret runs without the lock.
+type LifecycleCallbacks struct {
+	// OnInsert is called when an entry is added, before it is first fetched.
+	OnInsert func(info HookInfo)
+
+	// OnRefresh is called after each refresh of an entry, with the error if it failed.
+	OnRefresh func(info HookInfo, err error)
+
+	// OnEvict is called when an entry is dropped, after its data was wiped.
+	// Evicting a secret evicts its versions first, with the same reason.
+	OnEvict func(info HookInfo, reason EvictionReason)
+}
+
+// onInsert calls the OnInsert callback, if any.
+func (c CacheConfig) onInsert(info HookInfo) {
+	if c.Lifecycle.OnInsert != nil {
+		c.Lifecycle.OnInsert(info)
+	}
+}
+
+// onRefresh calls the OnRefresh callback, if any.
+func (c CacheConfig) onRefresh(info HookInfo, err error) {
+	if c.Lifecycle.OnRefresh != nil {
+		c.Lifecycle.OnRefresh(info, err)
+	}
+}
+
+// onEvict calls the OnEvict callback, if any.
+func (c CacheConfig) onEvict(info HookInfo, reason EvictionReason) {
+	if c.Lifecycle.OnEvict != nil {
+		c.Lifecycle.OnEvict(info, reason)
+	}
+}
+
+// Close drops every cached secret, wiping the cached data and reporting each
+// entry to OnEvict with EvictedClosed, and stops the cache's background work:
+// idle eviction and PrefetchMatching rescans.  Secrets being looked up are
+// wiped when their lookup finishes, without Close waiting for it.  The cache
+// must not be used after Close.  Always returns nil.
+func (c *Cache) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.evictAll(c.lru.removeAll(), EvictedClosed)
+	return nil
+}
+
+// sweepIdle evicts secrets not looked up within IdleTimeout until the cache is closed.
+func (c *Cache) sweepIdle() {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-c.clock().After(c.IdleTimeout / 2):
+		}
+
+		c.evictIdle()
+	}
+}
+
+// evictIdle evicts the secrets not looked up within IdleTimeout.
+func (c *Cache) evictIdle() {
+	cutoff := c.clock().Now().Add(-c.IdleTimeout).UnixNano()
+	c.evictAll(c.lru.removeOldestWhile(func(data interface{}) bool {
+		return data.(*secretCacheItem).lastAccessTime.Load() <= cutoff
+	}), EvictedIdle)
+}
@@ -0,0 +1,299 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+// Records lifecycle events as "<event> <kind> <secret id>[/<version id>][ <detail>]"
+type lifecycleRecorder struct {
+	mux    sync.Mutex
+	events []string
+}
+
+func (r *lifecycleRecorder) record(event string, info secretcache.HookInfo, detail string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	entry := event + " " + info.Kind.String() + " " + info.SecretId
+	if info.VersionId != "" {
+		entry += "/" + info.VersionId
+	}
+	if detail != "" {
+		entry += " " + detail
+	}
+	r.events = append(r.events, entry)
+}
+
+func (r *lifecycleRecorder) callbacks() secretcache.LifecycleCallbacks {
+	return secretcache.LifecycleCallbacks{
+		OnInsert: func(info secretcache.HookInfo) { r.record("insert", info, "") },
+		OnRefresh: func(info secretcache.HookInfo, err error) {
+			detail := ""
+			if err != nil {
+				detail = err.Error()
+			}
+			r.record("refresh", info, detail)
+		},
+		OnEvict: func(info secretcache.HookInfo, reason secretcache.EvictionReason) {
+			r.record("evict", info, reason.String())
+		},
+	}
+}
+
+func (r *lifecycleRecorder) recorded() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	return slices.Clone(r.events)
+}
+
+func (r *lifecycleRecorder) evictions() []string {
+	var evictions []string
+	for _, event := range r.recorded() {
+		if event[:5] == "evict" {
+			evictions = append(evictions, event)
+		}
+	}
+
+	return evictions
+}
+
+func TestLifecycleInsertAndRefresh(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	recorder := &lifecycleRecorder{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	expected := []string{
+		"insert description dummy-secret-name",
+		"refresh description dummy-secret-name",
+		"insert value dummy-secret-name/very-random-uuid",
+		"refresh value dummy-secret-name/very-random-uuid",
+	}
+	if events := recorder.recorded(); !slices.Equal(events, expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+}
+
+func TestLifecycleRefreshError(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	mockClient.DescribeSecretErr = errors.New("describe failed")
+	recorder := &lifecycleRecorder{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	expected := []string{
+		"insert description dummy-secret-name",
+		"refresh description dummy-secret-name describe failed",
+	}
+	if events := recorder.recorded(); !slices.Equal(events, expected) {
+		t.Fatalf("Expected events %v, got %v", expected, events)
+	}
+}
+
+func TestLifecycleCapacityEviction(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	recorder := &lifecycleRecorder{}
+	hook := &WipingCacheHook{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHook(hook),
+		secretcache.WithMaxCacheSize(1),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	_, _ = secretCache.GetSecretString("other-secret-name")
+
+	expected := []string{
+		"evict value dummy-secret-name/very-random-uuid capacity",
+		"evict description dummy-secret-name capacity",
+	}
+	if evictions := recorder.evictions(); !slices.Equal(evictions, expected) {
+		t.Fatalf("Expected evictions %v, got %v", expected, evictions)
+	}
+
+	if len(hook.wiped) != 2 {
+		t.Fatalf("Expected the evicted value and description to be wiped, got %d", len(hook.wiped))
+	}
+
+	if evictions := secretCache.Stats().Evictions; evictions != 2 {
+		t.Fatalf("Expected 2 evictions, got %d", evictions)
+	}
+}
+
+func TestLifecycleCapacityEvictionDuringLookup(t *testing.T) {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	client := &perSecretClient{mockSecretsManagerClient: mockClient, gates: map[string]chan struct{}{"slow": make(chan struct{})}}
+	recorder := &lifecycleRecorder{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithMaxCacheSize(1),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := secretCache.GetSecretString("slow")
+		slow <- err
+	}()
+	waitFor(t, func() bool { return client.calls.Load() == 1 })
+
+	// Evicting the secret being looked up does not wait for the lookup.
+	other := make(chan error, 1)
+	go func() {
+		_, err := secretCache.GetSecretString("other")
+		other <- err
+	}()
+	select {
+	case err := <-other:
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the lookup not to wait for the evicted secret's lookup")
+	}
+
+	close(client.gates["slow"])
+	if err := <-slow; err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	expected := []string{
+		"evict value slow/very-random-uuid capacity",
+		"evict description slow capacity",
+	}
+	if evictions := recorder.evictions(); !slices.Equal(evictions, expected) {
+		t.Fatalf("Expected evictions %v, got %v", expected, evictions)
+	}
+}
+
+func TestLifecyclePrunedVersionInvalidated(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	recorder := &lifecycleRecorder{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(secretcachetest.NewFakeClock(time.Now())),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	mockClient.MockedDescribeResult = &secretsmanager.DescribeSecretOutput{
+		VersionIdsToStages: map[string][]string{"new-random-uuid": {"AWSCURRENT"}},
+	}
+	secretCache.RefreshNow(secretId)
+
+	expected := []string{"evict value dummy-secret-name/very-random-uuid invalidated"}
+	if evictions := recorder.evictions(); !slices.Equal(evictions, expected) {
+		t.Fatalf("Expected evictions %v, got %v", expected, evictions)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	recorder := &lifecycleRecorder{}
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithIdleTimeout(time.Minute),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+	defer secretCache.Close()
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	// Still in use at the first sweep.
+	waitFor(t, func() bool { return clock.Waiters() == 1 })
+	clock.Advance(30 * time.Second)
+	waitFor(t, func() bool { return clock.Waiters() == 1 })
+
+	if evictions := recorder.evictions(); len(evictions) != 0 {
+		t.Fatalf("Expected no evictions yet, got %v", evictions)
+	}
+
+	clock.Advance(30 * time.Second)
+
+	expected := []string{
+		"evict value dummy-secret-name/very-random-uuid idle",
+		"evict description dummy-secret-name idle",
+	}
+	waitFor(t, func() bool { return len(recorder.evictions()) == len(expected) })
+
+	if evictions := recorder.evictions(); !slices.Equal(evictions, expected) {
+		t.Fatalf("Expected evictions %v, got %v", expected, evictions)
+	}
+
+	if _, err := secretCache.GetSecretString(secretId); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected the evicted secret to be fetched again, got %d calls", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestClose(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	recorder := &lifecycleRecorder{}
+	hook := &WipingCacheHook{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithHook(hook),
+		secretcache.WithLifecycleCallbacks(recorder.callbacks()),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if err := secretCache.Close(); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	expected := []string{
+		"evict value dummy-secret-name/very-random-uuid closed",
+		"evict description dummy-secret-name closed",
+	}
+	if evictions := recorder.evictions(); !slices.Equal(evictions, expected) {
+		t.Fatalf("Expected evictions %v, got %v", expected, evictions)
+	}
+
+	if len(hook.wiped) != 2 {
+		t.Fatalf("Expected the cached value and description to be wiped, got %d", len(hook.wiped))
+	}
+
+	// Closing again is harmless.
+	if err := secretCache.Close(); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+}
@@ -25,6 +25,10 @@ type lruCache struct {
 	mux          sync.Mutex
 	head         *lruItem
 	tail         *lruItem
+
+	// Called with the key and data of an item evicted to make room for a new
+	// one.  Runs after the cache lock is released.
+	onEvict func(key string, data interface{})
 }
 
 // lruItem is the cache item to hold data and linked list pointers.
@@ -60,17 +64,31 @@ func (l *lruCache) get(key string) (interface{}, bool) {
 	return item.data, true
 }
 
+// peek gets the cached item's data for the given key without marking it as used.
+func (l *lruCache) peek(key string) (interface{}, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	item, found := l.cacheMap[key]
+
+	if !found {
+		return nil, false
+	}
+
+	return item.data, true
+}
+
 // putIfAbsent puts an lruItem initialised from the given data in the cache.
 // Updates head of the linked list to be the new lruItem.
 // If cache size is over max allowed size, removes the tail item from cache.
 // Returns true if new key is inserted to cache, false if it already existed.
 func (l *lruCache) putIfAbsent(key string, data interface{}) bool {
 	l.mux.Lock()
-	defer l.mux.Unlock()
 
 	_, found := l.cacheMap[key]
 
 	if found {
+		l.mux.Unlock()
 		return false
 	}
 
@@ -80,15 +98,113 @@ func (l *lruCache) putIfAbsent(key string, data interface{}) bool {
 	l.cacheSize++
 	l.updateHead(item)
 
+	var evicted *lruItem
 	if l.cacheSize > l.cacheMaxSize {
-		delete(l.cacheMap, (*l.tail).key)
-		l.unlink(l.tail)
+		evicted = l.tail
+		delete(l.cacheMap, evicted.key)
+		l.unlink(evicted)
 		l.cacheSize--
 	}
 
+	l.mux.Unlock()
+
+	if evicted != nil && l.onEvict != nil {
+		l.onEvict(evicted.key, evicted.data)
+	}
+
 	return true
 }
 
+// remove removes the item with the given key from the cache.
+// Returns the removed item's data and a boolean to indicate it was found.
+func (l *lruCache) remove(key string) (interface{}, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	item, found := l.cacheMap[key]
+
+	if !found {
+		return nil, false
+	}
+
+	delete(l.cacheMap, key)
+	l.unlink(item)
+	l.cacheSize--
+
+	return item.data, true
+}
+
+// removeOldestWhile removes items, least recently used first, for as long as
+// the given function returns true for their data.
+// Returns the removed items' data.
+func (l *lruCache) removeOldestWhile(f func(data interface{}) bool) []interface{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	var removed []interface{}
+	for l.tail != nil && f(l.tail.data) {
+		item := l.tail
+		delete(l.cacheMap, item.key)
+		l.unlink(item)
+		l.cacheSize--
+		removed = append(removed, item.data)
+	}
+
+	return removed
+}
+
+// removeMatching removes the items whose key matches.
+// Returns the removed items' data.
+func (l *lruCache) removeMatching(match func(key string) bool) []interface{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	var removed []interface{}
+	for item := l.head; item != nil; {
+		next := item.next
+		if match(item.key) {
+			delete(l.cacheMap, item.key)
+			l.unlink(item)
+			l.cacheSize--
+			removed = append(removed, item.data)
+		}
+		item = next
+	}
+
+	return removed
+}
+
+// removeAll empties the cache.
+// Returns the removed items' data, most recently used first.
+func (l *lruCache) removeAll() []interface{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	removed := make([]interface{}, 0, l.cacheSize)
+	for item := l.head; item != nil; item = item.next {
+		removed = append(removed, item.data)
+	}
+
+	l.cacheMap = make(map[string]*lruItem)
+	l.cacheSize = 0
+	l.head = nil
+	l.tail = nil
+	return removed
+}
+
+// keys returns the cached keys, most recently used first.
+func (l *lruCache) keys() []string {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	keys := make([]string, 0, l.cacheSize)
+	for item := l.head; item != nil; item = item.next {
+		keys = append(keys, item.key)
+	}
+
+	return keys
+}
+
 // updateHead updates head of the linked list to be the input lruItem.
 func (l *lruCache) updateHead(item *lruItem) {
 	if l.head == item {
@@ -96,6 +212,7 @@ func (l *lruCache) updateHead(item *lruItem) {
 	}
 
 	l.unlink(item)
+	item.prev = nil
 	item.next = l.head
 
 	if l.head != nil {
@@ -14,6 +14,7 @@
 package secretcache
 
 import (
+	"slices"
 	"strconv"
 	"testing"
 )
@@ -162,6 +163,108 @@ func TestLRUCacheOne(t *testing.T) {
 	}
 }
 
+func TestLRUCacheRemove(t *testing.T) {
+	lruCache := newLRUCache(10)
+	for i := 0; i < 5; i++ {
+		lruCache.putIfAbsent(strconv.Itoa(i), i)
+	}
+
+	// Touch an item so that it is relinked at the head before removing it.
+	lruCache.get("0")
+
+	if val, found := lruCache.remove("0"); !found || val.(int) != 0 {
+		t.Fatalf("Expected to remove val from cache - %d", 0)
+	}
+
+	if _, found := lruCache.remove("0"); found {
+		t.Fatalf("Did not expect to remove val twice")
+	}
+
+	if _, found := lruCache.get("0"); found {
+		t.Fatalf("Found unexpected val in cache - %d", 0)
+	}
+
+	keys := lruCache.keys()
+	expected := []string{"4", "3", "2", "1"}
+
+	if len(keys) != len(expected) || lruCache.cacheSize != len(expected) {
+		t.Fatalf("Expected keys %v, got %v", expected, keys)
+	}
+
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Fatalf("Expected keys %v, got %v", expected, keys)
+		}
+	}
+}
+
+func TestLRUCacheRemoveMatching(t *testing.T) {
+	lruCache := newLRUCache(10)
+	for i := 0; i < 6; i++ {
+		lruCache.putIfAbsent(strconv.Itoa(i), i)
+	}
+
+	removed := lruCache.removeMatching(func(key string) bool {
+		i, _ := strconv.Atoi(key)
+		return i%2 == 0
+	})
+
+	if len(removed) != 3 || lruCache.cacheSize != 3 {
+		t.Fatalf("Expected 3 items removed and 3 left, got %v and %d", removed, lruCache.cacheSize)
+	}
+
+	if keys := lruCache.keys(); !slices.Equal(keys, []string{"5", "3", "1"}) {
+		t.Fatalf("Expected keys [5 3 1], got %v", keys)
+	}
+
+	if removed := lruCache.removeAll(); len(removed) != 3 || lruCache.cacheSize != 0 || len(lruCache.keys()) != 0 {
+		t.Fatalf("Expected the cache to be emptied, got %v", lruCache.keys())
+	}
+
+	lruCache.putIfAbsent("a", 1)
+	if _, found := lruCache.get("a"); !found {
+		t.Fatalf("Expected the emptied cache to be usable")
+	}
+}
+
+func TestLRUCacheRemoveOldestWhile(t *testing.T) {
+	lruCache := newLRUCache(10)
+	for i := 0; i < 5; i++ {
+		lruCache.putIfAbsent(strconv.Itoa(i), i)
+	}
+	lruCache.get("0")
+
+	// Stops at the first item kept, even though older ones would match.
+	removed := lruCache.removeOldestWhile(func(data interface{}) bool { return data.(int) != 3 })
+
+	if !slices.Equal(removed, []interface{}{1, 2}) {
+		t.Fatalf("Expected [1 2] removed, got %v", removed)
+	}
+
+	if keys := lruCache.keys(); !slices.Equal(keys, []string{"0", "4", "3"}) {
+		t.Fatalf("Expected keys [0 4 3], got %v", keys)
+	}
+}
+
+func TestLRUCacheOnEvict(t *testing.T) {
+	lruCache := newLRUCache(2)
+
+	var evicted []string
+	lruCache.onEvict = func(key string, data interface{}) {
+		evicted = append(evicted, key)
+	}
+
+	lruCache.putIfAbsent("a", 1)
+	lruCache.putIfAbsent("b", 2)
+	lruCache.get("a")
+	lruCache.putIfAbsent("c", 3)
+	lruCache.remove("a")
+
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("Expected only the least recently used key to be evicted, got %v", evicted)
+	}
+}
+
 func TestConcurrentAccess(t *testing.T) {
 	cache := newLRUCache(1)
 	cache.putIfAbsent("key", "value")
@@ -0,0 +1,48 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+//go:build linux
+
+package secretcache
+
+import (
+	"syscall"
+)
+
+// madvDontDump is MADV_DONTDUMP, which the syscall package does not define.
+const madvDontDump = 0x10
+
+// allocLocked maps pages of their own for a buffer of the given size, so that
+// unlocking it cannot unlock another buffer, locks them in memory and excludes
+// them from core dumps.
+func allocLocked(size int) ([]byte, error) {
+	buf, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Mlock(buf); err != nil {
+		_ = syscall.Munmap(buf)
+		return nil, err
+	}
+
+	// Best effort: older kernels do not support it.
+	_ = syscall.Madvise(buf, madvDontDump)
+	return buf, nil
+}
+
+// freeLocked unlocks and unmaps a buffer returned by allocLocked.
+func freeLocked(buf []byte) {
+	_ = syscall.Munlock(buf)
+	_ = syscall.Munmap(buf)
+}
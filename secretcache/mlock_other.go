@@ -0,0 +1,28 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+//go:build !linux
+
+package secretcache
+
+import (
+	"errors"
+)
+
+// allocLocked reports that locking memory is not supported on this platform.
+func allocLocked(int) ([]byte, error) {
+	return nil, errors.New("locking memory is only supported on Linux")
+}
+
+// freeLocked is never called, as allocLocked never succeeds.
+func freeLocked([]byte) {}
@@ -15,22 +15,27 @@ package secretcache_test
 
 import (
 	"context"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
 )
 
 // A struct to be used in unit tests as a mock Client
 type mockSecretsManagerClient struct {
 	secretcache.SecretsManagerAPIClient
-	MockedGetResult         *secretsmanager.GetSecretValueOutput
-	MockedDescribeResult    *secretsmanager.DescribeSecretOutput
-	GetSecretValueErr       error
-	DescribeSecretErr       error
-	GetSecretValueCallCount int
-	DescribeSecretCallCount int
+	MockedGetResult          *secretsmanager.GetSecretValueOutput
+	MockedGetResultByVersion map[string]*secretsmanager.GetSecretValueOutput
+	MockedDescribeResult     *secretsmanager.DescribeSecretOutput
+	GetSecretValueErr        error
+	DescribeSecretErr        error
+	GetSecretValueCallCount  int
+	GetSecretValueInputs     []*secretsmanager.GetSecretValueInput
+	DescribeSecretCallCount  int
 }
 
 // Initialises a mock Client with dummy outputs for GetSecretValue and DescribeSecret APIs
@@ -71,11 +76,21 @@ func newMockedClientWithDummyResults() (mockSecretsManagerClient, string, string
 // Overrides the interface method to return dummy result.
 func (m *mockSecretsManagerClient) GetSecretValue(context context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
 	m.GetSecretValueCallCount++
+	m.GetSecretValueInputs = append(m.GetSecretValueInputs, input)
 
 	if m.GetSecretValueErr != nil {
 		return nil, m.GetSecretValueErr
 	}
 
+	// Results can be mocked per version id or per version stage.
+	if result, found := m.MockedGetResultByVersion[aws.ToString(input.VersionId)]; found {
+		return result, nil
+	}
+
+	if result, found := m.MockedGetResultByVersion[aws.ToString(input.VersionStage)]; found {
+		return result, nil
+	}
+
 	return m.MockedGetResult, nil
 }
 
@@ -90,6 +105,80 @@ func (m *mockSecretsManagerClient) DescribeSecret(context context.Context, input
 	return m.MockedDescribeResult, nil
 }
 
+// A mock Client that also supports the BatchGetSecretValue API
+type mockBatchSecretsManagerClient struct {
+	mockSecretsManagerClient
+	MockedSecrets                map[string]types.SecretValueEntry
+	BatchGetSecretValueErr       error
+	BatchGetSecretValueCallCount int
+}
+
+// Initialises a mock batch Client with count secrets named "secret-<i>"
+func newMockedBatchClient(count int) *mockBatchSecretsManagerClient {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	secrets := make(map[string]types.SecretValueEntry)
+
+	for i := 0; i < count; i++ {
+		name := "secret-" + strconv.Itoa(i)
+		secrets[name] = types.SecretValueEntry{
+			ARN:           getStrPtr("arn:" + name),
+			Name:          getStrPtr(name),
+			SecretString:  getStrPtr("value of " + name),
+			VersionId:     getStrPtr("version-of-" + name),
+			VersionStages: []string{"AWSCURRENT"},
+		}
+	}
+
+	return &mockBatchSecretsManagerClient{mockSecretsManagerClient: mockClient, MockedSecrets: secrets}
+}
+
+// Returns the mocked secrets requested by id, or every mocked secret a page at a time when filtering.
+func (m *mockBatchSecretsManagerClient) BatchGetSecretValue(context context.Context, input *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	m.BatchGetSecretValueCallCount++
+
+	if m.BatchGetSecretValueErr != nil {
+		return nil, m.BatchGetSecretValueErr
+	}
+
+	output := &secretsmanager.BatchGetSecretValueOutput{}
+
+	if len(input.Filters) == 0 {
+		for _, secretId := range input.SecretIdList {
+			if entry, found := m.MockedSecrets[secretId]; found {
+				output.SecretValues = append(output.SecretValues, entry)
+				continue
+			}
+
+			output.Errors = append(output.Errors, types.APIErrorType{
+				SecretId:  getStrPtr(secretId),
+				ErrorCode: getStrPtr("ResourceNotFoundException"),
+				Message:   getStrPtr("Secrets Manager can't find the specified secret."),
+			})
+		}
+
+		return output, nil
+	}
+
+	var names []string
+	for name := range m.MockedSecrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start, _ := strconv.Atoi(aws.ToString(input.NextToken))
+	end := min(start+int(aws.ToInt32(input.MaxResults)), len(names))
+
+	for _, name := range names[start:end] {
+		output.SecretValues = append(output.SecretValues, m.MockedSecrets[name])
+	}
+
+	if end < len(names) {
+		output.NextToken = getStrPtr(strconv.Itoa(end))
+	}
+
+	return output, nil
+}
+
 // Helper function to get a string pointer for input string.
 func getStrPtr(str string) *string {
 	return aws.String(str)
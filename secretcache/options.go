@@ -0,0 +1,163 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// The functions below build options for New. They can be mixed freely with
+// options that set Cache fields directly; the resulting configuration is
+// validated once all options have been applied.
+
+// WithMaxCacheSize sets the maximum number of cached secrets.
+func WithMaxCacheSize(size int) func(*Cache) {
+	return func(c *Cache) { c.MaxCacheSize = size }
+}
+
+// WithMaxVersionsPerSecret sets the maximum number of versions cached for each secret.
+func WithMaxVersionsPerSecret(size int) func(*Cache) {
+	return func(c *Cache) { c.MaxVersionsPerSecret = size }
+}
+
+// WithTTL sets how long a cached item is considered valid before it is refreshed.
+func WithTTL(ttl time.Duration) func(*Cache) {
+	return func(c *Cache) {
+		c.TTL = ttl
+		c.CacheItemTTL = ttl.Nanoseconds()
+	}
+}
+
+// WithVersionStage sets the version stage used when no stage is requested explicitly.
+func WithVersionStage(versionStage string) func(*Cache) {
+	return func(c *Cache) { c.VersionStage = versionStage }
+}
+
+// WithDirectStageLookup sets whether values are looked up by version stage
+// without calling DescribeSecret.
+func WithDirectStageLookup(enabled bool) func(*Cache) {
+	return func(c *Cache) { c.DirectStageLookup = enabled }
+}
+
+// WithDeletedSecretPolicy sets how secrets scheduled for deletion are treated.
+func WithDeletedSecretPolicy(policy DeletedSecretPolicy) func(*Cache) {
+	return func(c *Cache) { c.DeletedSecretPolicy = policy }
+}
+
+// WithClient sets the client used to call AWS Secrets Manager.
+func WithClient(client SecretsManagerAPIClient) func(*Cache) {
+	return func(c *Cache) { c.Client = client }
+}
+
+// WithHook sets the hook applied to in-memory cache updates.
+func WithHook(hook CacheHook) func(*Cache) {
+	return func(c *Cache) { c.Hook = hook }
+}
+
+// WithHookV2 sets the hook applied to in-memory cache updates, with context and errors.
+func WithHookV2(hook CacheHookV2) func(*Cache) {
+	return func(c *Cache) { c.HookV2 = hook }
+}
+
+// WithLogger sets the logger used to report cache activity.
+func WithLogger(logger *slog.Logger) func(*Cache) {
+	return func(c *Cache) { c.Logger = logger }
+}
+
+// WithClock sets the source of time used for expiry and backoff.
+func WithClock(clock Clock) func(*Cache) {
+	return func(c *Cache) { c.Clock = clock }
+}
+
+// WithRandSource sets the source of randomness used for refresh jitter.
+func WithRandSource(src rand.Source) func(*Cache) {
+	return func(c *Cache) { c.RandSource = src }
+}
+
+// WithJitter sets the strategy used to spread out refresh times.
+func WithJitter(jitter JitterStrategy) func(*Cache) {
+	return func(c *Cache) { c.Jitter = jitter }
+}
+
+// WithScheduler sets the scheduler that adjusts refresh times to each secret's metadata.
+func WithScheduler(scheduler RefreshScheduler) func(*Cache) {
+	return func(c *Cache) { c.Scheduler = scheduler }
+}
+
+// WithHedging sends a second GetSecretValue or DescribeSecret call to client
+// when the first has not answered within delay.  A nil client hedges to the
+// cache's Client.
+func WithHedging(delay time.Duration, client SecretsManagerAPIClient) func(*Cache) {
+	return func(c *Cache) {
+		c.HedgeDelay = delay
+		c.HedgeClient = client
+	}
+}
+
+// WithRateLimit limits the cache to perSecond GetSecretValue, DescribeSecret and
+// BatchGetSecretValue calls per second, with bursts of up to burst calls.
+func WithRateLimit(perSecond float64, burst int) func(*Cache) {
+	return func(c *Cache) {
+		c.RateLimit = perSecond
+		c.RateBurst = burst
+	}
+}
+
+// WithCircuitBreaker opens the circuit breaker after threshold consecutive
+// failed calls and lets a trial call through after cooldown.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) func(*Cache) {
+	return func(c *Cache) {
+		c.CircuitBreakerThreshold = threshold
+		c.CircuitBreakerCooldown = cooldown
+	}
+}
+
+// WithMaxConcurrentRequests caps the number of GetSecretValue, DescribeSecret and
+// BatchGetSecretValue calls in flight at once.
+func WithMaxConcurrentRequests(limit int) func(*Cache) {
+	return func(c *Cache) { c.MaxConcurrentRequests = limit }
+}
+
+// WithRefreshTimeout detaches refresh calls from their caller's context and
+// bounds them by timeout instead.
+func WithRefreshTimeout(timeout time.Duration) func(*Cache) {
+	return func(c *Cache) { c.RefreshTimeout = timeout }
+}
+
+// WithIdleTimeout evicts secrets not looked up within timeout.
+func WithIdleTimeout(timeout time.Duration) func(*Cache) {
+	return func(c *Cache) { c.IdleTimeout = timeout }
+}
+
+// WithLifecycleCallbacks sets the callbacks told about entries added to,
+// refreshed in and evicted from the cache.
+func WithLifecycleCallbacks(callbacks LifecycleCallbacks) func(*Cache) {
+	return func(c *Cache) { c.Lifecycle = callbacks }
+}
+
+// WithSecureMemory keeps cached secrets in buffers that are wiped when they
+// leave the cache, locked in memory if lock is set.
+func WithSecureMemory(lock bool) func(*Cache) {
+	return func(c *Cache) {
+		c.SecureMemory = true
+		c.LockMemory = lock
+	}
+}
+
+// WithCacheConfig replaces the whole cache configuration.
+func WithCacheConfig(config CacheConfig) func(*Cache) {
+	return func(c *Cache) { c.CacheConfig = config }
+}
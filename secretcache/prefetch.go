@@ -0,0 +1,192 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+)
+
+// The number of secrets, or batches of secrets, loaded at the same time by PrefetchMatching by default.
+const DefaultPrefetchConcurrency = 4
+
+// PrefetchOptions configures PrefetchMatching.
+type PrefetchOptions struct {
+	// The maximum number of secrets, or batches of secrets when the client supports
+	// BatchGetSecretValue, loaded at the same time.  Defaults to DefaultPrefetchConcurrency.
+	Concurrency int
+
+	// When positive, ListSecrets is called again at this interval and newly matching
+	// secrets are loaded, until the context passed to PrefetchMatching is done.
+	RescanInterval time.Duration
+}
+
+// PrefetchMatching pages through ListSecrets with the given filters, for example by name
+// prefix or tag, and loads every matching secret into the cache.
+// When opts.RescanInterval is set, a background goroutine keeps picking up newly created
+// secrets until ctx is done or the cache is closed; failures during rescans are reported through the logger.
+// Returns an error if listing fails, or a *BatchError listing the secrets that could not be loaded.
+func (c *Cache) PrefetchMatching(ctx context.Context, filters []types.Filter, optFns ...func(*PrefetchOptions)) error {
+	opts := PrefetchOptions{Concurrency: DefaultPrefetchConcurrency}
+	for _, optFn := range optFns {
+		optFn(&opts)
+	}
+
+	if opts.Concurrency <= 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "prefetch concurrency must be positive",
+			},
+		}
+	}
+
+	secretIds, err := c.listSecretIds(ctx, filters)
+	if err != nil {
+		return err
+	}
+
+	err = c.prefetchConcurrently(ctx, secretIds, opts.Concurrency)
+
+	if opts.RescanInterval > 0 {
+		seen := make(map[string]bool, len(secretIds))
+		for _, secretId := range secretIds {
+			seen[secretId] = true
+		}
+
+		go c.rescan(WithBackgroundPriority(ctx), filters, opts, seen)
+	}
+
+	return err
+}
+
+// rescan periodically lists the secrets matching filters and loads those not seen before.
+func (c *Cache) rescan(ctx context.Context, filters []types.Filter, opts PrefetchOptions, seen map[string]bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.closed:
+			return
+		case <-c.clock().After(opts.RescanInterval):
+		}
+
+		secretIds, err := c.listSecretIds(ctx, filters)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger().Warn("failed to rescan secrets", "error", err)
+			}
+			continue
+		}
+
+		var newIds []string
+		for _, secretId := range secretIds {
+			if !seen[secretId] {
+				newIds = append(newIds, secretId)
+			}
+		}
+
+		if len(newIds) == 0 {
+			continue
+		}
+
+		c.logger().Debug("prefetching new secrets", "count", len(newIds))
+
+		err = c.prefetchConcurrently(ctx, newIds, opts.Concurrency)
+
+		var batchErr *BatchError
+		errors.As(err, &batchErr)
+		for _, secretId := range newIds {
+			if batchErr == nil || batchErr.Errors[secretId] == nil {
+				seen[secretId] = true
+			}
+		}
+
+		if err != nil && ctx.Err() == nil {
+			c.logger().Warn("failed to prefetch new secrets", "error", err)
+		}
+	}
+}
+
+// listSecretIds pages through ListSecrets and returns the names of the matching secrets.
+func (c *Cache) listSecretIds(ctx context.Context, filters []types.Filter) ([]string, error) {
+	var secretIds []string
+	input := &secretsmanager.ListSecretsInput{Filters: filters}
+
+	for {
+		output, err := c.Client.ListSecrets(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range output.SecretList {
+			if entry.Name != nil {
+				secretIds = append(secretIds, aws.ToString(entry.Name))
+			}
+		}
+
+		if output.NextToken == nil {
+			return secretIds, nil
+		}
+
+		input.NextToken = output.NextToken
+	}
+}
+
+// prefetchConcurrently loads the given secrets with Prefetch, running at most concurrency
+// calls at a time.  Each call loads one BatchGetSecretValue request worth of secrets, or a
+// single secret for clients without batch support.
+// Returns a *BatchError listing the secrets that could not be loaded.
+func (c *Cache) prefetchConcurrently(ctx context.Context, secretIds []string, concurrency int) error {
+	chunkSize := 1
+	if _, ok := c.Client.(BatchGetSecretValueAPIClient); ok {
+		chunkSize = batchGetSecretValueMaxIds
+	}
+
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	sem := make(chan struct{}, concurrency)
+
+	for start := 0; start < len(secretIds); start += chunkSize {
+		chunk := secretIds[start:min(start+chunkSize, len(secretIds))]
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var batchErr *BatchError
+			if err := c.Prefetch(ctx, chunk); errors.As(err, &batchErr) {
+				mux.Lock()
+				defer mux.Unlock()
+
+				for secretId, secretErr := range batchErr.Errors {
+					errs[secretId] = secretErr
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return newBatchError(errs)
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+// A mock Client listing a changing set of secrets, safe for concurrent use.
+// Tracks how many calls are in flight at once.
+type listingClient struct {
+	secretcache.SecretsManagerAPIClient
+	mux         sync.Mutex
+	names       []string
+	fetched     map[string]int
+	inFlight    int
+	maxInFlight int
+}
+
+func newListingClient(names ...string) *listingClient {
+	return &listingClient{names: names, fetched: make(map[string]int)}
+}
+
+func (l *listingClient) addSecret(name string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.names = append(l.names, name)
+}
+
+func (l *listingClient) fetchCount(name string) int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return l.fetched[name]
+}
+
+// Lists the secrets matching a name filter, ten at a time.
+func (l *listingClient) ListSecrets(ctx context.Context, input *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	var matching []string
+	for _, name := range l.names {
+		if strings.HasPrefix(name, input.Filters[0].Values[0]) {
+			matching = append(matching, name)
+		}
+	}
+
+	start, _ := strconv.Atoi(aws.ToString(input.NextToken))
+	end := min(start+10, len(matching))
+	output := &secretsmanager.ListSecretsOutput{}
+
+	for _, name := range matching[start:end] {
+		output.SecretList = append(output.SecretList, types.SecretListEntry{Name: aws.String(name)})
+	}
+
+	if end < len(matching) {
+		output.NextToken = aws.String(strconv.Itoa(end))
+	}
+
+	return output, nil
+}
+
+func (l *listingClient) DescribeSecret(ctx context.Context, input *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	l.enter()
+	defer l.exit()
+
+	return &secretsmanager.DescribeSecretOutput{
+		Name:               input.SecretId,
+		VersionIdsToStages: map[string][]string{"version-of-" + *input.SecretId: {"AWSCURRENT"}},
+	}, nil
+}
+
+func (l *listingClient) GetSecretValue(ctx context.Context, input *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	l.enter()
+	defer l.exit()
+
+	l.mux.Lock()
+	l.fetched[*input.SecretId]++
+	l.mux.Unlock()
+
+	return &secretsmanager.GetSecretValueOutput{
+		Name:         input.SecretId,
+		SecretString: aws.String("value of " + *input.SecretId),
+		VersionId:    input.VersionId,
+	}, nil
+}
+
+func (l *listingClient) enter() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.inFlight++
+	l.maxInFlight = max(l.maxInFlight, l.inFlight)
+}
+
+func (l *listingClient) exit() {
+	// Keep the call in flight long enough for others to overlap it.
+	time.Sleep(time.Millisecond)
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.inFlight--
+}
+
+// waitFor polls condition until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var tenantFilter = []types.Filter{{Key: types.FilterNameStringTypeName, Values: []string{"tenant/"}}}
+
+func TestPrefetchMatching(t *testing.T) {
+	var names []string
+	for i := 0; i < 25; i++ {
+		names = append(names, "tenant/"+strconv.Itoa(i))
+	}
+	mockClient := newListingClient(append(names, "other/0")...)
+	secretCache, _ := secretcache.New(secretcache.WithClient(mockClient))
+
+	err := secretCache.PrefetchMatching(context.Background(), tenantFilter,
+		func(o *secretcache.PrefetchOptions) { o.Concurrency = 3 },
+	)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	for _, name := range names {
+		if mockClient.fetchCount(name) != 1 {
+			t.Fatalf("Expected %s to be prefetched once, got %d", name, mockClient.fetchCount(name))
+		}
+	}
+
+	if mockClient.fetchCount("other/0") != 0 {
+		t.Fatalf("Expected secrets not matching the filter to be skipped")
+	}
+
+	if mockClient.maxInFlight > 3 {
+		t.Fatalf("Expected at most 3 calls in flight, got %d", mockClient.maxInFlight)
+	}
+
+	if result, err := secretCache.GetSecretString("tenant/7"); err != nil || result != "value of tenant/7" {
+		t.Fatalf("Expected a prefetched secret to be served")
+	}
+
+	if mockClient.fetchCount("tenant/7") != 1 {
+		t.Fatalf("Expected a prefetched secret to be served from cache")
+	}
+}
+
+func TestPrefetchMatchingRescan(t *testing.T) {
+	mockClient := newListingClient("tenant/0")
+	clock := secretcachetest.NewFakeClock(time.Now())
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(mockClient),
+		secretcache.WithClock(clock),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := secretCache.PrefetchMatching(ctx, tenantFilter,
+		func(o *secretcache.PrefetchOptions) { o.RescanInterval = time.Minute },
+	)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	waitFor(t, func() bool { return clock.Waiters() == 1 })
+	mockClient.addSecret("tenant/1")
+	clock.Advance(time.Minute)
+
+	waitFor(t, func() bool { return mockClient.fetchCount("tenant/1") == 1 })
+
+	// Secrets that were already loaded are not prefetched again.
+	waitFor(t, func() bool { return clock.Waiters() == 1 })
+
+	if mockClient.fetchCount("tenant/0") != 1 {
+		t.Fatalf("Expected the known secret to be loaded once, got %d", mockClient.fetchCount("tenant/0"))
+	}
+
+	cancel()
+}
+
+func TestPrefetchMatchingInvalidConcurrency(t *testing.T) {
+	secretCache, _ := secretcache.New(secretcache.WithClient(newListingClient()))
+
+	err := secretCache.PrefetchMatching(context.Background(), tenantFilter,
+		func(o *secretcache.PrefetchOptions) { o.Concurrency = 0 },
+	)
+
+	if err == nil {
+		t.Fatalf("Expected an error for zero concurrency")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
+)
+
+const (
+	throttleRetryDelayBase = 1000   // milliseconds
+	throttleRetryDelayMax  = 300000 // milliseconds
+)
+
+// tokenBucket is a token bucket rate limiter refilled at rate tokens per
+// second, holding at most burst tokens.
+type tokenBucket struct {
+	mux    sync.Mutex
+	clock  Clock
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket for the rate limit of config.
+func newTokenBucket(config CacheConfig) *tokenBucket {
+	burst := float64(config.RateBurst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(config.RateLimit))
+	}
+
+	return &tokenBucket{
+		clock:  config.clock(),
+		rate:   config.RateLimit,
+		burst:  burst,
+		tokens: burst,
+		last:   config.clock().Now(),
+	}
+}
+
+// refill adds the tokens accrued since the last call.  Must be called with the lock held.
+func (b *tokenBucket) refill() {
+	now := b.clock.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// tryTake takes a token if one is available without waiting.
+func (b *tokenBucket) tryTake() bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// wait takes a token, waiting for one to accrue if the bucket is empty.
+// Returns the context's error if it is done first, in which case no token is taken.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mux.Lock()
+	b.refill()
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mux.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-b.clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		b.mux.Lock()
+		b.tokens++
+		b.mux.Unlock()
+		return ctx.Err()
+	}
+}
+
+// rateLimitedClient makes GetSecretValue, DescribeSecret and BatchGetSecretValue
+// calls take a token from a shared bucket first.  Other calls go to the wrapped client unchanged.
+type rateLimitedClient struct {
+	SecretsManagerAPIClient
+	bucket *tokenBucket
+}
+
+func (r *rateLimitedClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return r.SecretsManagerAPIClient.GetSecretValue(ctx, params, optFns...)
+}
+
+func (r *rateLimitedClient) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return r.SecretsManagerAPIClient.DescribeSecret(ctx, params, optFns...)
+}
+
+func (r *rateLimitedClient) BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return callBatchGetSecretValue(ctx, r.SecretsManagerAPIClient, params, optFns...)
+}
+
+// wait takes a token for a call.  Calls that can fall back to a cached value
+// fail with a *RateLimitExceededError instead of waiting for one.
+func (r *rateLimitedClient) wait(ctx context.Context) error {
+	if !hasStaleFallback(ctx) {
+		return r.bucket.wait(ctx)
+	}
+
+	if r.bucket.tryTake() {
+		return nil
+	}
+
+	return &RateLimitExceededError{
+		baseError{
+			Message: "rate limit exceeded, serving the cached value",
+		},
+	}
+}
+
+// staleFallbackKey marks the context of a refresh whose cached value can be served if it fails.
+type staleFallbackKey struct{}
+
+func withStaleFallback(ctx context.Context) context.Context {
+	return context.WithValue(ctx, staleFallbackKey{}, true)
+}
+
+func hasStaleFallback(ctx context.Context) bool {
+	fallback, _ := ctx.Value(staleFallbackKey{}).(bool)
+	return fallback
+}
+
+// isThrottlingError reports whether err means that requests are being throttled,
+// by AWS Secrets Manager or by the cache's own rate limit.
+func isThrottlingError(err error) bool {
+	var rateErr *RateLimitExceededError
+	if errors.As(err, &rateErr) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ThrottlingException", "Throttling", "TooManyRequestsException", "RequestLimitExceeded":
+			return true
+		}
+	}
+
+	var statusErr interface{ HTTPStatusCode() int }
+	return errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == 429
+}
+
+// throttleRetryDelay returns the jittered delay before retrying a throttled
+// request, growing with the number of consecutive errors.
+func (o *cacheObject) throttleRetryDelay() time.Duration {
+	delay := throttleRetryDelayBase * math.Pow(exceptionRetryGrowthFactor, float64(o.errorCount-1))
+	delay = math.Min(delay, throttleRetryDelayMax)
+	return o.config.jitter().Jitter(time.Millisecond*time.Duration(delay), o.config.rand())
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+	"github.com/aws/smithy-go"
+)
+
+func TestRateLimitDelaysCalls(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithRateLimit(1, 1),
+	)
+
+	if _, err := secretCache.GetSecretString(secretId); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	done := make(chan string)
+	go func() {
+		value, _ := secretCache.GetSecretString("other-secret")
+		done <- value
+	}()
+
+	// The second secret waits for the bucket to refill.
+	waitFor(t, func() bool { return clock.Waiters() > 0 })
+	clock.Advance(time.Second)
+
+	if value := <-done; value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	if mockClient.GetSecretValueCallCount != 2 {
+		t.Fatalf("Expected 2 calls, got %d", mockClient.GetSecretValueCallCount)
+	}
+}
+
+func TestRateLimitWaitAbandoned(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithRateLimit(1, 1),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := secretCache.GetSecretStringWithContext(ctx, "other-secret")
+		done <- err
+	}()
+
+	waitFor(t, func() bool { return clock.Waiters() > 0 })
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the wait to be cancelled, got %v", err)
+	}
+
+	if mockClient.GetSecretValueCallCount != 1 {
+		t.Fatalf("Expected 1 call, got %d", mockClient.GetSecretValueCallCount)
+	}
+}
+
+func TestRateLimitServesCachedValue(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithTTL(time.Minute),
+		secretcache.WithRateLimit(0.001, 1),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	clock.Advance(2 * time.Minute)
+
+	// The refresh does not wait for a token and the cached value is served.
+	value, err := secretCache.GetSecretString(secretId)
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if value != secretString {
+		t.Fatalf("Expected %s, got %s", secretString, value)
+	}
+
+	if mockClient.GetSecretValueCallCount != 1 {
+		t.Fatalf("Expected 1 call, got %d", mockClient.GetSecretValueCallCount)
+	}
+
+	if throttled := secretCache.Stats().ThrottledRequests; throttled != 1 {
+		t.Fatalf("Expected 1 throttled request, got %d", throttled)
+	}
+}
+
+func TestThrottlingErrorBacksOff(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithTTL(time.Minute),
+		secretcache.WithJitter(secretcache.NoJitter{}),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+
+	mockClient.DescribeSecretErr = &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	clock.Advance(time.Minute)
+
+	if value, _ := secretCache.GetSecretString(secretId); value != secretString {
+		t.Fatalf("Expected the cached value %s, got %s", secretString, value)
+	}
+
+	// Other errors are retried after a few milliseconds; throttling waits longer.
+	clock.Advance(500 * time.Millisecond)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected 2 describe calls, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 3 {
+		t.Fatalf("Expected 3 describe calls, got %d", mockClient.DescribeSecretCallCount)
+	}
+
+	if throttled := secretCache.Stats().ThrottledRequests; throttled != 2 {
+		t.Fatalf("Expected 2 throttled requests, got %d", throttled)
+	}
+}
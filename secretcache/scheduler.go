@@ -0,0 +1,117 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+const (
+	DefaultPostRotationDelay   = time.Minute
+	DefaultStaticTTLMultiplier = 4
+)
+
+// jitteringScheduler is a RefreshScheduler that draws some of its delays from
+// the cache's JitterStrategy.
+type jitteringScheduler interface {
+	nextRefresh(secret *secretsmanager.DescribeSecretOutput, now time.Time, jittered time.Duration, jitter func(time.Duration) time.Duration) time.Duration
+}
+
+// RefreshScheduler decides when a secret is refreshed next, based on what
+// DescribeSecret returned for it. It is not consulted for secrets cached with
+// DirectStageLookup or Prefetch, which do not call DescribeSecret.
+type RefreshScheduler interface {
+	// NextRefresh returns the delay until the next refresh of the described
+	// secret. jittered is the delay the cache would use without a scheduler,
+	// drawn from the configured TTL and JitterStrategy.
+	NextRefresh(secret *secretsmanager.DescribeSecretOutput, now time.Time, jittered time.Duration) time.Duration
+}
+
+// RotationAwareScheduler adapts refresh times to each secret's rotation schedule.
+// A secret with rotation enabled is refreshed shortly after its next scheduled
+// rotation if that comes before its regular refresh, which shrinks the window in
+// which a rotated secret is served stale. A secret without rotation is refreshed
+// less often, saving API calls for static secrets.
+type RotationAwareScheduler struct {
+	// How long after NextRotationDate to refresh, giving the rotation time to
+	// complete.  The cache applies its JitterStrategy to it, so that caches
+	// sharing a secret do not all refresh it at once.  Defaults to
+	// DefaultPostRotationDelay when zero.
+	PostRotationDelay time.Duration
+
+	// The factor applied to the refresh delay of secrets without rotation.
+	// Defaults to DefaultStaticTTLMultiplier when zero.
+	StaticTTLMultiplier float64
+}
+
+// validate checks the scheduler for negative delays.
+// Returns an InvalidConfigError describing the first problem found.
+func (s RotationAwareScheduler) validate() error {
+	if s.PostRotationDelay < 0 {
+		return &InvalidConfigError{
+			baseError{
+				Message: "post rotation delay cannot be negative",
+			},
+		}
+	}
+
+	if !(s.StaticTTLMultiplier >= 0) {
+		return &InvalidConfigError{
+			baseError{
+				Message: "static ttl multiplier cannot be negative",
+			},
+		}
+	}
+
+	return nil
+}
+
+func (s RotationAwareScheduler) NextRefresh(secret *secretsmanager.DescribeSecretOutput, now time.Time, jittered time.Duration) time.Duration {
+	return s.nextRefresh(secret, now, jittered, func(delay time.Duration) time.Duration { return delay })
+}
+
+// nextRefresh is NextRefresh with the post rotation delay passed through jitter.
+func (s RotationAwareScheduler) nextRefresh(secret *secretsmanager.DescribeSecretOutput, now time.Time, jittered time.Duration, jitter func(time.Duration) time.Duration) time.Duration {
+	if secret == nil {
+		return jittered
+	}
+
+	if secret.RotationEnabled == nil || !*secret.RotationEnabled {
+		multiplier := s.StaticTTLMultiplier
+		if multiplier == 0 {
+			multiplier = DefaultStaticTTLMultiplier
+		}
+
+		return time.Duration(float64(jittered) * multiplier)
+	}
+
+	if secret.NextRotationDate == nil {
+		return jittered
+	}
+
+	delay := s.PostRotationDelay
+	if delay == 0 {
+		delay = DefaultPostRotationDelay
+	}
+
+	// A rotation that is already due may still be running, keep the regular delay.
+	untilRotated := secret.NextRotationDate.Add(jitter(delay)).Sub(now)
+	if untilRotated > 0 && untilRotated < jittered {
+		return untilRotated
+	}
+
+	return jittered
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+func TestRotationAwareSchedulerNextRefresh(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduler := secretcache.RotationAwareScheduler{PostRotationDelay: time.Minute, StaticTTLMultiplier: 3}
+	soon := now.Add(10 * time.Minute)
+	later := now.Add(48 * time.Hour)
+	past := now.Add(-time.Hour)
+
+	testCases := map[string]struct {
+		secret   *secretsmanager.DescribeSecretOutput
+		expected time.Duration
+	}{
+		"no description":       {nil, time.Hour},
+		"rotation disabled":    {&secretsmanager.DescribeSecretOutput{RotationEnabled: aws.Bool(false)}, 3 * time.Hour},
+		"rotation not set":     {&secretsmanager.DescribeSecretOutput{}, 3 * time.Hour},
+		"rotation soon":        {&secretsmanager.DescribeSecretOutput{RotationEnabled: aws.Bool(true), NextRotationDate: &soon}, 11 * time.Minute},
+		"rotation later":       {&secretsmanager.DescribeSecretOutput{RotationEnabled: aws.Bool(true), NextRotationDate: &later}, time.Hour},
+		"rotation overdue":     {&secretsmanager.DescribeSecretOutput{RotationEnabled: aws.Bool(true), NextRotationDate: &past}, time.Hour},
+		"rotation unscheduled": {&secretsmanager.DescribeSecretOutput{RotationEnabled: aws.Bool(true)}, time.Hour},
+	}
+
+	for name, testCase := range testCases {
+		if actual := scheduler.NextRefresh(testCase.secret, now, time.Hour); actual != testCase.expected {
+			t.Fatalf("%s: expected next refresh in %s, got %s", name, testCase.expected, actual)
+		}
+	}
+}
+
+func TestRotationAwareRefreshAfterRotation(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+	nextRotation := clock.Now().Add(10 * time.Minute)
+	mockClient.MockedDescribeResult.RotationEnabled = aws.Bool(true)
+	mockClient.MockedDescribeResult.NextRotationDate = &nextRotation
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithScheduler(secretcache.RotationAwareScheduler{}),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	clock.Advance(10 * time.Minute)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 1 {
+		t.Fatalf("Expected no refresh before the rotation has completed, got %d DescribeSecret calls", mockClient.DescribeSecretCallCount)
+	}
+
+	clock.Advance(secretcache.DefaultPostRotationDelay)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected a refresh shortly after the rotation, got %d DescribeSecret calls", mockClient.DescribeSecretCallCount)
+	}
+}
+
+func TestRotationAwareRefreshJittered(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	now := time.Now()
+	nextRotation := now.Add(10 * time.Minute)
+	mockClient.MockedDescribeResult.RotationEnabled = aws.Bool(true)
+	mockClient.MockedDescribeResult.NextRotationDate = &nextRotation
+
+	// A fleet of caches does not refresh the rotated secret at the same instant.
+	refreshTimes := make(map[time.Time]bool)
+	for i := int64(0); i < 10; i++ {
+		secretCache, _ := secretcache.New(
+			secretcache.WithClient(&mockClient),
+			secretcache.WithClock(secretcachetest.NewFakeClock(now)),
+			secretcache.WithRandSource(rand.NewSource(i)),
+			secretcache.WithScheduler(secretcache.RotationAwareScheduler{}),
+		)
+		_, _ = secretCache.GetSecretString(secretId)
+
+		for entry := range secretCache.Entries() {
+			earliest := nextRotation.Add(secretcache.DefaultPostRotationDelay / 2)
+			latest := nextRotation.Add(secretcache.DefaultPostRotationDelay)
+			if entry.NextRefreshTime.Before(earliest) || !entry.NextRefreshTime.Before(latest) {
+				t.Fatalf("Expected a refresh within the post rotation delay, got %s after the rotation", entry.NextRefreshTime.Sub(nextRotation))
+			}
+			refreshTimes[entry.NextRefreshTime] = true
+		}
+	}
+
+	if len(refreshTimes) < 5 {
+		t.Fatalf("Expected the refreshes to be spread out, got %d distinct times", len(refreshTimes))
+	}
+}
+
+func TestRotationAwareStaticSecret(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	clock := secretcachetest.NewFakeClock(time.Now())
+
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithClock(clock),
+		secretcache.WithTTL(time.Hour),
+		secretcache.WithScheduler(secretcache.RotationAwareScheduler{}),
+	)
+
+	_, _ = secretCache.GetSecretString(secretId)
+	clock.Advance(2 * time.Hour)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 1 {
+		t.Fatalf("Expected the ttl of a static secret to be stretched, got %d DescribeSecret calls", mockClient.DescribeSecretCallCount)
+	}
+
+	clock.Advance(2 * time.Hour)
+	_, _ = secretCache.GetSecretString(secretId)
+
+	if mockClient.DescribeSecretCallCount != 2 {
+		t.Fatalf("Expected a refresh after the stretched ttl, got %d DescribeSecret calls", mockClient.DescribeSecretCallCount)
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+// Package secretcachedebug serves the state of a secretcache.Cache over HTTP,
+// in the manner of net/http/pprof.  Secret values are never served.
+//
+// Mount the handler under a path ending in a slash:
+//
+//	http.Handle("/debug/secretcache/", secretcachedebug.New(cache))
+//
+// The handler serves, relative to that path:
+//
+//	GET  .                       an HTML page of the cache's config, stats, entries and errors
+//	GET  state.json              the same as JSON
+//	POST invalidate?secretId=id  drops a secret with Cache.Invalidate
+//	POST refresh?secretId=id     refreshes a cached secret with Cache.RefreshCached
+//
+// The POST endpoints are allowed for every same-origin request unless
+// Options.Authorize is set.  Cross-site requests, as told by their Sec-Fetch-Site
+// or Origin header, are always rejected.
+package secretcachedebug
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+)
+
+// Options configures the handler.
+type Options struct {
+	// Authorize decides whether a POST request may change the cache.  Requests
+	// it rejects fail with 403 Forbidden.  When nil, every request may.
+	Authorize func(r *http.Request) bool
+}
+
+// handler is the http.Handler returned by New.
+type handler struct {
+	cache *secretcache.Cache
+	Options
+}
+
+// New returns an http.Handler serving the state of cache.
+func New(cache *secretcache.Cache, optFns ...func(*Options)) http.Handler {
+	h := &handler{cache: cache}
+	for _, optFn := range optFns {
+		optFn(&h.Options)
+	}
+
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch name := path.Base(r.URL.Path); name {
+	case "invalidate", "refresh":
+		h.serveAction(w, r, name)
+	case "state.json":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, h.state())
+	default:
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := indexTemplate.Execute(w, h.state()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// serveAction invalidates or refreshes the secret named by the secretId parameter.
+func (h *handler) serveAction(w http.ResponseWriter, r *http.Request, action string) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if isCrossSite(r) || (h.Authorize != nil && !h.Authorize(r)) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	secretId := r.FormValue("secretId")
+	if secretId == "" {
+		http.Error(w, "missing secretId", http.StatusBadRequest)
+		return
+	}
+
+	result := actionResult{SecretId: secretId, Action: action}
+	if action == "invalidate" {
+		result.Found = h.cache.Invalidate(secretId)
+	} else if result.Found = h.cache.RefreshCached(r.Context(), secretId); result.Found {
+		for entry := range h.cache.Entries() {
+			if entry.SecretId == secretId {
+				view := newEntryView(entry)
+				result.Entry = &view
+				break
+			}
+		}
+	}
+
+	// Forms posted from the HTML page go back to it.
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, ".", http.StatusSeeOther)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// isCrossSite reports whether the request was sent by a page of another site,
+// such as a form posted to the handler by a malicious page.
+func isCrossSite(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	originURL, err := url.Parse(origin)
+	return err != nil || originURL.Host != r.Host
+}
+
+// allowMethod fails the request with 405 Method Not Allowed unless it uses the given method.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method || (method == http.MethodGet && r.Method == http.MethodHead) {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+// state is the cache state served by the handler.
+type state struct {
+	Config       configView  `json:"config"`
+	Stats        statsView   `json:"stats"`
+	Entries      []entryView `json:"entries"`
+	RecentErrors []entryView `json:"recentErrors"`
+}
+
+// configView is the part of the cache config worth showing; hooks and clients by type only.
+type configView struct {
+	MaxCacheSize            int     `json:"maxCacheSize"`
+	MaxVersionsPerSecret    int     `json:"maxVersionsPerSecret"`
+	TTL                     string  `json:"ttl"`
+	VersionStage            string  `json:"versionStage"`
+	DirectStageLookup       bool    `json:"directStageLookup"`
+	DeletedSecretPolicy     int     `json:"deletedSecretPolicy"`
+	HedgeDelay              string  `json:"hedgeDelay,omitempty"`
+	RateLimit               float64 `json:"rateLimit,omitempty"`
+	RateBurst               int     `json:"rateBurst,omitempty"`
+	CircuitBreakerThreshold int     `json:"circuitBreakerThreshold,omitempty"`
+	CircuitBreakerCooldown  string  `json:"circuitBreakerCooldown,omitempty"`
+	MaxConcurrentRequests   int     `json:"maxConcurrentRequests,omitempty"`
+	RefreshTimeout          string  `json:"refreshTimeout,omitempty"`
+	IdleTimeout             string  `json:"idleTimeout,omitempty"`
+	SecureMemory            bool    `json:"secureMemory"`
+	LockMemory              bool    `json:"lockMemory"`
+	Client                  string  `json:"client"`
+	Hook                    string  `json:"hook,omitempty"`
+}
+
+// statsView is secretcache.Stats with the circuit state as text.
+type statsView struct {
+	Refreshes                uint64 `json:"refreshes"`
+	RefreshErrors            uint64 `json:"refreshErrors"`
+	DeletedSecretLookups     uint64 `json:"deletedSecretLookups"`
+	HedgedRequests           uint64 `json:"hedgedRequests"`
+	ThrottledRequests        uint64 `json:"throttledRequests"`
+	CircuitBreakerTrips      uint64 `json:"circuitBreakerTrips"`
+	CircuitBreakerRejections uint64 `json:"circuitBreakerRejections"`
+	Evictions                uint64 `json:"evictions"`
+	CircuitState             string `json:"circuitState"`
+}
+
+// entryView is a secretcache.Entry with the error as text and unset times left out.
+type entryView struct {
+	SecretId        string            `json:"secretId"`
+	Stages          map[string]string `json:"stages,omitempty"`
+	LastRefreshTime *time.Time        `json:"lastRefreshTime,omitempty"`
+	NextRefreshTime *time.Time        `json:"nextRefreshTime,omitempty"`
+	ErrorCount      int               `json:"errorCount"`
+	LastError       string            `json:"lastError,omitempty"`
+	BackoffUntil    *time.Time        `json:"backoffUntil,omitempty"`
+	Stale           bool              `json:"stale"`
+	LRUPosition     int               `json:"lruPosition"`
+	Region          string            `json:"region,omitempty"`
+	Busy            bool              `json:"busy,omitempty"`
+}
+
+// actionResult is the response to a POST request.
+type actionResult struct {
+	SecretId string     `json:"secretId"`
+	Action   string     `json:"action"`
+	Found    bool       `json:"found"`
+	Entry    *entryView `json:"entry,omitempty"`
+}
+
+// state collects the state of the cache.
+func (h *handler) state() state {
+	s := state{
+		Config:       newConfigView(h.cache),
+		Stats:        newStatsView(h.cache.Stats()),
+		Entries:      []entryView{},
+		RecentErrors: []entryView{},
+	}
+
+	for entry := range h.cache.Entries() {
+		view := newEntryView(entry)
+		s.Entries = append(s.Entries, view)
+		if entry.LastError != nil {
+			s.RecentErrors = append(s.RecentErrors, view)
+		}
+	}
+
+	// The latest failures back off the furthest.
+	slices.SortStableFunc(s.RecentErrors, func(a, b entryView) int {
+		return cmp.Compare(timeOrZero(b.BackoffUntil).UnixNano(), timeOrZero(a.BackoffUntil).UnixNano())
+	})
+
+	return s
+}
+
+func newConfigView(cache *secretcache.Cache) configView {
+	config := cache.CacheConfig
+	ttl := config.TTL
+	if ttl == 0 {
+		ttl = time.Duration(config.CacheItemTTL)
+	}
+	if ttl == 0 {
+		ttl = time.Duration(secretcache.DefaultCacheItemTTL)
+	}
+
+	view := configView{
+		MaxCacheSize:            config.MaxCacheSize,
+		MaxVersionsPerSecret:    cmp.Or(config.MaxVersionsPerSecret, secretcache.DefaultMaxVersionsPerSecret),
+		TTL:                     ttl.String(),
+		VersionStage:            cmp.Or(config.VersionStage, secretcache.DefaultVersionStage),
+		DirectStageLookup:       config.DirectStageLookup,
+		DeletedSecretPolicy:     int(config.DeletedSecretPolicy),
+		HedgeDelay:              durationOrEmpty(config.HedgeDelay),
+		RateLimit:               config.RateLimit,
+		RateBurst:               config.RateBurst,
+		CircuitBreakerThreshold: config.CircuitBreakerThreshold,
+		CircuitBreakerCooldown:  durationOrEmpty(config.CircuitBreakerCooldown),
+		MaxConcurrentRequests:   config.MaxConcurrentRequests,
+		RefreshTimeout:          durationOrEmpty(config.RefreshTimeout),
+		IdleTimeout:             durationOrEmpty(config.IdleTimeout),
+		SecureMemory:            config.SecureMemory,
+		LockMemory:              config.LockMemory,
+		Client:                  fmt.Sprintf("%T", cache.Client),
+	}
+
+	if config.HookV2 != nil {
+		view.Hook = fmt.Sprintf("%T", config.HookV2)
+	} else if config.Hook != nil {
+		view.Hook = fmt.Sprintf("%T", config.Hook)
+	}
+
+	return view
+}
+
+func newStatsView(stats secretcache.Stats) statsView {
+	return statsView{
+		Refreshes:                stats.Refreshes,
+		RefreshErrors:            stats.RefreshErrors,
+		DeletedSecretLookups:     stats.DeletedSecretLookups,
+		HedgedRequests:           stats.HedgedRequests,
+		ThrottledRequests:        stats.ThrottledRequests,
+		CircuitBreakerTrips:      stats.CircuitBreakerTrips,
+		CircuitBreakerRejections: stats.CircuitBreakerRejections,
+		Evictions:                stats.Evictions,
+		CircuitState:             stats.CircuitState.String(),
+	}
+}
+
+func newEntryView(entry secretcache.Entry) entryView {
+	view := entryView{
+		SecretId:        entry.SecretId,
+		Stages:          entry.Stages,
+		LastRefreshTime: timeOrNil(entry.LastRefreshTime),
+		NextRefreshTime: timeOrNil(entry.NextRefreshTime),
+		ErrorCount:      entry.ErrorCount,
+		BackoffUntil:    timeOrNil(entry.BackoffUntil),
+		Stale:           entry.Stale,
+		LRUPosition:     entry.LRUPosition,
+		Region:          entry.Region,
+		Busy:            entry.Busy,
+	}
+
+	if entry.LastError != nil {
+		view.LastError = entry.LastError.Error()
+	}
+
+	return view
+}
+
+func durationOrEmpty(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"formatTime": func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>secretcache</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>secretcache</h1>
+<p><a href="state.json">state.json</a></p>
+
+<h2>Config</h2>
+<table>
+<tr><th>Max cache size</th><td>{{.Config.MaxCacheSize}}</td></tr>
+<tr><th>Max versions per secret</th><td>{{.Config.MaxVersionsPerSecret}}</td></tr>
+<tr><th>TTL</th><td>{{.Config.TTL}}</td></tr>
+<tr><th>Version stage</th><td>{{.Config.VersionStage}}</td></tr>
+<tr><th>Direct stage lookup</th><td>{{.Config.DirectStageLookup}}</td></tr>
+<tr><th>Client</th><td>{{.Config.Client}}</td></tr>
+{{with .Config.Hook}}<tr><th>Hook</th><td>{{.}}</td></tr>{{end}}
+{{with .Config.HedgeDelay}}<tr><th>Hedge delay</th><td>{{.}}</td></tr>{{end}}
+{{with .Config.RateLimit}}<tr><th>Rate limit</th><td>{{.}}/s</td></tr>{{end}}
+{{with .Config.CircuitBreakerThreshold}}<tr><th>Circuit breaker threshold</th><td>{{.}}</td></tr>{{end}}
+{{with .Config.MaxConcurrentRequests}}<tr><th>Max concurrent requests</th><td>{{.}}</td></tr>{{end}}
+{{with .Config.RefreshTimeout}}<tr><th>Refresh timeout</th><td>{{.}}</td></tr>{{end}}
+{{with .Config.IdleTimeout}}<tr><th>Idle timeout</th><td>{{.}}</td></tr>{{end}}
+<tr><th>Secure memory</th><td>{{.Config.SecureMemory}} (locked: {{.Config.LockMemory}})</td></tr>
+</table>
+
+<h2>Stats</h2>
+<table>
+<tr><th>Refreshes</th><td>{{.Stats.Refreshes}}</td></tr>
+<tr><th>Refresh errors</th><td>{{.Stats.RefreshErrors}}</td></tr>
+<tr><th>Deleted secret lookups</th><td>{{.Stats.DeletedSecretLookups}}</td></tr>
+<tr><th>Hedged requests</th><td>{{.Stats.HedgedRequests}}</td></tr>
+<tr><th>Throttled requests</th><td>{{.Stats.ThrottledRequests}}</td></tr>
+<tr><th>Circuit breaker</th><td>{{.Stats.CircuitState}} ({{.Stats.CircuitBreakerTrips}} trips, {{.Stats.CircuitBreakerRejections}} rejections)</td></tr>
+<tr><th>Evictions</th><td>{{.Stats.Evictions}}</td></tr>
+</table>
+
+<h2>Recent errors</h2>
+{{if .RecentErrors}}
+<table>
+<tr><th>Secret</th><th>Errors</th><th>Last error</th><th>Backoff until</th></tr>
+{{range .RecentErrors}}<tr><td>{{.SecretId}}</td><td>{{.ErrorCount}}</td><td>{{.LastError}}</td><td>{{formatTime .BackoffUntil}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>{{end}}
+
+<h2>Entries</h2>
+<table>
+<tr><th>#</th><th>Secret</th><th>Stages</th><th>Last refresh</th><th>Next refresh</th><th>Errors</th><th>Backoff until</th><th></th></tr>
+{{range .Entries}}<tr>
+<td>{{.LRUPosition}}</td>
+<td>{{.SecretId}}{{with .Region}} ({{.}}){{end}}</td>
+<td>{{range $stage, $versionId := .Stages}}{{$stage}}: {{$versionId}}<br>{{end}}</td>
+<td>{{formatTime .LastRefreshTime}}</td>
+<td>{{formatTime .NextRefreshTime}}</td>
+<td>{{.ErrorCount}}{{with .LastError}}: {{.}}{{end}}</td>
+<td>{{formatTime .BackoffUntil}}</td>
+<td>
+<form method="post" action="refresh"><input type="hidden" name="secretId" value="{{.SecretId}}"><button>Refresh</button></form>
+<form method="post" action="invalidate"><input type="hidden" name="secretId" value="{{.SecretId}}"><button>Invalidate</button></form>
+</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
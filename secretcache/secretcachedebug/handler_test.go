@@ -0,0 +1,313 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcachedebug_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachedebug"
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+const secretString = "my secret string"
+
+// A client serving the same secret value for every secret id except "broken"
+type secretClient struct {
+	secretcache.SecretsManagerAPIClient
+	calls atomic.Int32
+}
+
+func (c *secretClient) GetSecretValue(_ context.Context, input *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	c.calls.Add(1)
+	if aws.ToString(input.SecretId) == "broken" {
+		return nil, errors.New("access denied")
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		SecretString:  aws.String(secretString),
+		VersionId:     aws.String("dummy-version"),
+		VersionStages: []string{"AWSCURRENT"},
+	}, nil
+}
+
+func newTestCache(t *testing.T) (*secretcache.Cache, *secretClient) {
+	client := &secretClient{}
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(client),
+		secretcache.WithDirectStageLookup(true),
+		secretcache.WithClock(secretcachetest.NewFakeClock(time.Now())),
+	)
+
+	for _, secretId := range []string{"healthy", "broken"} {
+		_, _ = secretCache.GetSecretString(secretId)
+	}
+
+	t.Cleanup(func() { _ = secretCache.Close() })
+	return secretCache, client
+}
+
+func serve(handler http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestStateJSON(t *testing.T) {
+	secretCache, _ := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+
+	response := serve(handler, http.MethodGet, "/debug/secretcache/state.json", nil)
+
+	if response.Code != http.StatusOK || response.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON response, got %d %s", response.Code, response.Header().Get("Content-Type"))
+	}
+
+	if strings.Contains(response.Body.String(), secretString) {
+		t.Fatalf("Expected no secret values, got %s", response.Body.String())
+	}
+
+	var state struct {
+		Config struct {
+			MaxCacheSize int
+			VersionStage string
+		}
+		Stats struct {
+			RefreshErrors uint64
+			CircuitState  string
+		}
+		Entries []struct {
+			SecretId string
+			Stages   map[string]string
+		}
+		RecentErrors []struct {
+			SecretId  string
+			LastError string
+		}
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &state); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if state.Config.MaxCacheSize != secretcache.DefaultMaxCacheSize || state.Config.VersionStage != "AWSCURRENT" {
+		t.Fatalf("Expected the default config, got %+v", state.Config)
+	}
+
+	if state.Stats.RefreshErrors != 1 || state.Stats.CircuitState != "closed" {
+		t.Fatalf("Expected 1 refresh error and a closed circuit, got %+v", state.Stats)
+	}
+
+	if len(state.Entries) != 2 || state.Entries[1].SecretId != "healthy" || state.Entries[1].Stages["AWSCURRENT"] != "dummy-version" {
+		t.Fatalf("Expected both entries, got %+v", state.Entries)
+	}
+
+	if len(state.RecentErrors) != 1 || state.RecentErrors[0].SecretId != "broken" || state.RecentErrors[0].LastError != "access denied" {
+		t.Fatalf("Expected the broken secret's error, got %+v", state.RecentErrors)
+	}
+}
+
+func TestIndexHTML(t *testing.T) {
+	secretCache, _ := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+
+	response := serve(handler, http.MethodGet, "/debug/secretcache/", nil)
+	body := response.Body.String()
+
+	if response.Code != http.StatusOK || !strings.HasPrefix(response.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected an HTML response, got %d %s", response.Code, response.Header().Get("Content-Type"))
+	}
+
+	if !strings.Contains(body, "healthy") || !strings.Contains(body, "access denied") {
+		t.Fatalf("Expected the entries and errors, got %s", body)
+	}
+
+	if strings.Contains(body, secretString) {
+		t.Fatalf("Expected no secret values, got %s", body)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	secretCache, client := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+
+	response := serve(handler, http.MethodPost, "/debug/secretcache/invalidate?secretId=healthy", nil)
+
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"found": true`) {
+		t.Fatalf("Expected the secret to be invalidated, got %d %s", response.Code, response.Body.String())
+	}
+
+	calls := client.calls.Load()
+	_, _ = secretCache.GetSecretString("healthy")
+
+	if client.calls.Load() != calls+1 {
+		t.Fatalf("Expected the invalidated secret to be fetched again")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	secretCache, client := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+	calls := client.calls.Load()
+
+	response := serve(handler, http.MethodPost, "/debug/secretcache/refresh?secretId=healthy", nil)
+
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"secretId": "healthy"`) {
+		t.Fatalf("Expected the refreshed entry, got %d %s", response.Code, response.Body.String())
+	}
+
+	if client.calls.Load() != calls+1 {
+		t.Fatalf("Expected the secret to be fetched again")
+	}
+
+	if strings.Contains(response.Body.String(), secretString) {
+		t.Fatalf("Expected no secret values, got %s", response.Body.String())
+	}
+}
+
+func TestPostFromHTMLRedirects(t *testing.T) {
+	secretCache, _ := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+
+	response := serve(handler, http.MethodPost, "/debug/secretcache/invalidate?secretId=healthy", http.Header{"Accept": {"text/html"}})
+
+	if response.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect, got %d", response.Code)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	secretCache, _ := newTestCache(t)
+	handler := secretcachedebug.New(secretCache, func(o *secretcachedebug.Options) {
+		o.Authorize = func(r *http.Request) bool { return r.Header.Get("X-Token") == "let-me-in" }
+	})
+
+	response := serve(handler, http.MethodPost, "/debug/secretcache/invalidate?secretId=healthy", nil)
+
+	if response.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d", response.Code)
+	}
+
+	response = serve(handler, http.MethodPost, "/debug/secretcache/invalidate?"+url.Values{"secretId": {"healthy"}}.Encode(), http.Header{"X-Token": {"let-me-in"}})
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", response.Code)
+	}
+}
+
+func TestMethodsAndParameters(t *testing.T) {
+	secretCache, _ := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+
+	testCases := []struct {
+		method, target string
+		status         int
+	}{
+		{http.MethodGet, "/debug/secretcache/invalidate?secretId=healthy", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/debug/secretcache/state.json", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/debug/secretcache/", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/debug/secretcache/refresh", http.StatusBadRequest},
+	}
+
+	for _, testCase := range testCases {
+		if response := serve(handler, testCase.method, testCase.target, nil); response.Code != testCase.status {
+			t.Fatalf("%s %s: expected %d, got %d", testCase.method, testCase.target, testCase.status, response.Code)
+		}
+	}
+}
+
+func TestRefreshUncached(t *testing.T) {
+	secretCache, client := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+	calls := client.calls.Load()
+
+	response := serve(handler, http.MethodPost, "/debug/secretcache/refresh?secretId=unknown", nil)
+
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"found": false`) {
+		t.Fatalf("Expected the secret not to be found, got %d %s", response.Code, response.Body.String())
+	}
+
+	if client.calls.Load() != calls {
+		t.Fatalf("Expected no calls for an uncached secret")
+	}
+
+	for entry := range secretCache.Entries() {
+		if entry.SecretId == "unknown" {
+			t.Fatalf("Expected the secret not to be cached")
+		}
+	}
+}
+
+func TestCrossSiteRequests(t *testing.T) {
+	secretCache, _ := newTestCache(t)
+	handler := secretcachedebug.New(secretCache)
+	target := "http://example.com/debug/secretcache/invalidate?secretId=healthy"
+
+	testCases := []struct {
+		header http.Header
+		status int
+	}{
+		{http.Header{"Sec-Fetch-Site": {"cross-site"}}, http.StatusForbidden},
+		{http.Header{"Sec-Fetch-Site": {"same-site"}}, http.StatusForbidden},
+		{http.Header{"Origin": {"http://attacker.example"}}, http.StatusForbidden},
+		{http.Header{"Origin": {"http://example.com"}}, http.StatusOK},
+		{http.Header{"Sec-Fetch-Site": {"same-origin"}}, http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		if response := serve(handler, http.MethodPost, target, testCase.header); response.Code != testCase.status {
+			t.Fatalf("%v: expected %d, got %d", testCase.header, testCase.status, response.Code)
+		}
+	}
+}
+
+func TestStateJSONKeys(t *testing.T) {
+	mockClient := &secretClient{}
+	secretCache, _ := secretcache.New(secretcache.WithClient(mockClient))
+	t.Cleanup(func() { _ = secretCache.Close() })
+	handler := secretcachedebug.New(secretCache)
+
+	response := serve(handler, http.MethodGet, "/debug/secretcache/state.json", nil)
+
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal(response.Body.Bytes(), &state); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if string(state["entries"]) != "[]" || string(state["recentErrors"]) != "[]" {
+		t.Fatalf("Expected empty lists, got %s and %s", state["entries"], state["recentErrors"])
+	}
+
+	var stats map[string]interface{}
+	_ = json.Unmarshal(state["stats"], &stats)
+
+	if _, found := stats["refreshErrors"]; !found || stats["circuitState"] != "closed" {
+		t.Fatalf("Expected camelCase stats, got %s", state["stats"])
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+// Package secretcachetest provides helpers for testing code that uses the secretcache package.
+package secretcachetest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+)
+
+var _ secretcache.Clock = (*FakeClock)(nil)
+
+// FakeClock is a manually driven secretcache.Clock. Time only moves when
+// Advance or Set is called, or when a goroutine calls Sleep, which advances
+// the clock by the requested duration instead of blocking.
+type FakeClock struct {
+	mux     sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a pending After call.
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the fake current time.
+func (c *FakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.now
+}
+
+// Sleep advances the clock by d and returns immediately.
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// After returns a channel that receives the fake time once the clock has
+// been moved at least d past the current time.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, &waiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d, firing any After channels whose
+// deadline has been reached.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.setLocked(c.now.Add(d))
+}
+
+// Set moves the clock to the given time, firing any After channels whose
+// deadline has been reached. Moving the clock backwards is allowed.
+func (c *FakeClock) Set(now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.setLocked(now)
+}
+
+// Waiters returns the number of After channels that have not fired yet.
+// Tests can use it to wait until a goroutine is blocked on the clock.
+func (c *FakeClock) Waiters() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return len(c.waiters)
+}
+
+// setLocked updates the time and fires expired waiters. c.mux must be held.
+func (c *FakeClock) setLocked(now time.Time) {
+	c.now = now
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if now.Before(w.deadline) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- now
+	}
+	c.waiters = pending
+}
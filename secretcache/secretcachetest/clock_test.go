@@ -0,0 +1,59 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcachetest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache/secretcachetest"
+)
+
+func TestFakeClockAdvance(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := secretcachetest.NewFakeClock(start)
+
+	clock.Sleep(time.Minute)
+
+	if !clock.Now().Equal(start.Add(time.Minute)) {
+		t.Fatalf("Expected Sleep to advance the clock by a minute, got %s", clock.Now())
+	}
+
+	ch := clock.After(time.Second)
+
+	select {
+	case <-ch:
+		t.Fatalf("Expected After channel not to fire before the clock is advanced")
+	default:
+	}
+
+	if clock.Waiters() != 1 {
+		t.Fatalf("Expected one waiter, got %d", clock.Waiters())
+	}
+
+	clock.Advance(time.Second)
+
+	select {
+	case fired := <-ch:
+		if !fired.Equal(start.Add(time.Minute + time.Second)) {
+			t.Fatalf("Unexpected fire time %s", fired)
+		}
+	default:
+		t.Fatalf("Expected After channel to fire once the deadline is reached")
+	}
+
+	if clock.Waiters() != 0 {
+		t.Fatalf("Expected no waiters, got %d", clock.Waiters())
+	}
+}
@@ -26,3 +26,26 @@ type SecretsManagerAPIClient interface {
 	ListSecrets(ctx context.Context, params *secretsmanager.ListSecretsInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.ListSecretsOutput, error)
 	UpdateSecret(ctx context.Context, params *secretsmanager.UpdateSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.UpdateSecretOutput, error)
 }
+
+// BatchGetSecretValueAPIClient is implemented by clients that support the
+// BatchGetSecretValue API, such as *secretsmanager.Client. It is separate from
+// SecretsManagerAPIClient so that existing custom clients keep compiling; the
+// cache checks for it when fetching secrets in bulk.
+type BatchGetSecretValueAPIClient interface {
+	BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error)
+}
+
+// callBatchGetSecretValue calls BatchGetSecretValue on client.
+// Returns an *InvalidOperationError if the client does not support it.
+func callBatchGetSecretValue(ctx context.Context, client SecretsManagerAPIClient, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	batchClient, ok := client.(BatchGetSecretValueAPIClient)
+	if !ok {
+		return nil, &InvalidOperationError{
+			baseError{
+				Message: "client does not support BatchGetSecretValue",
+			},
+		}
+	}
+
+	return batchClient.BatchGetSecretValue(ctx, params, optFns...)
+}
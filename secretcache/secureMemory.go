@@ -0,0 +1,117 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secureValue holds the SecretString and SecretBinary of a cached secret
+// version, one after the other, in a buffer of its own that is wiped when the
+// value leaves the cache.
+type secureValue struct {
+	buf []byte
+
+	// The length of the SecretString at the start of buf, or -1 if there is none.
+	stringLen int
+	hasBinary bool
+
+	// Set when buf was allocated by allocLocked and must be freed with freeLocked.
+	locked bool
+}
+
+// newSecureValue copies the secret of value into a secureValue, locking it in
+// memory if lock is set.
+// Returns the secureValue, a copy of value without its secret and, if the
+// secret could not be locked, the reason; the secureValue is usable regardless.
+func newSecureValue(value *secretsmanager.GetSecretValueOutput, lock bool) (*secureValue, *secretsmanager.GetSecretValueOutput, error) {
+	s := &secureValue{stringLen: -1, hasBinary: value.SecretBinary != nil}
+	size := len(value.SecretBinary)
+	if value.SecretString != nil {
+		s.stringLen = len(*value.SecretString)
+		size += s.stringLen
+	}
+
+	var lockErr error
+	if lock && size > 0 {
+		s.buf, lockErr = allocLocked(size)
+		s.locked = lockErr == nil
+	}
+
+	if !s.locked {
+		s.buf = make([]byte, size)
+	}
+
+	n := 0
+	if value.SecretString != nil {
+		n = copy(s.buf, *value.SecretString)
+	}
+	copy(s.buf[n:], value.SecretBinary)
+
+	stripped := *value
+	stripped.SecretString = nil
+	stripped.SecretBinary = nil
+	return s, &stripped, lockErr
+}
+
+// restore returns a copy of stripped with copies of the secret put back.
+func (s *secureValue) restore(stripped *secretsmanager.GetSecretValueOutput) *secretsmanager.GetSecretValueOutput {
+	value := *stripped
+	n := max(s.stringLen, 0)
+	if s.stringLen >= 0 {
+		secretString := string(s.buf[:n])
+		value.SecretString = &secretString
+	}
+	if s.hasBinary {
+		value.SecretBinary = append([]byte{}, s.buf[n:]...)
+	}
+
+	return &value
+}
+
+// view returns the secret's SecretBinary, or its SecretString if it has no
+// binary, without copying it.  The view is only valid until the next wipe.
+func (s *secureValue) view() []byte {
+	if s.hasBinary {
+		return s.buf[max(s.stringLen, 0):]
+	}
+
+	return s.buf[:max(s.stringLen, 0)]
+}
+
+// wipe zeroes the buffer and releases it.
+func (s *secureValue) wipe() {
+	clear(s.buf)
+	if s.locked {
+		freeLocked(s.buf)
+	}
+
+	s.buf = nil
+	s.stringLen = -1
+	s.hasBinary = false
+	s.locked = false
+}
+
+// secretBytes returns the secret's SecretBinary, or its SecretString if it has no binary.
+func secretBytes(value *secretsmanager.GetSecretValueOutput) []byte {
+	if value.SecretBinary != nil {
+		return value.SecretBinary
+	}
+
+	if value.SecretString != nil {
+		return []byte(*value.SecretString)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-secretsmanager-caching-go/v2/secretcache"
+)
+
+func newBinarySecretClient() *mockSecretsManagerClient {
+	mockClient, _, _ := newMockedClientWithDummyResults()
+	mockClient.MockedGetResult.SecretString = nil
+	mockClient.MockedGetResult.SecretBinary = []byte("my secret binary")
+	return &mockClient
+}
+
+func TestSecureMemoryReturnsCopies(t *testing.T) {
+	for _, lock := range []bool{false, true} {
+		mockClient := newBinarySecretClient()
+		secretCache, _ := secretcache.New(
+			secretcache.WithClient(mockClient),
+			secretcache.WithSecureMemory(lock),
+		)
+
+		first, err := secretCache.GetSecretBinary("dummy-secret-name")
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+
+		first[0] = 'X'
+		second, _ := secretCache.GetSecretBinary("dummy-secret-name")
+
+		if string(second) != "my secret binary" {
+			t.Fatalf("Expected the cached secret to be unchanged, got %s", second)
+		}
+
+		if !bytes.Equal(mockClient.MockedGetResult.SecretBinary, make([]byte, len("my secret binary"))) {
+			t.Fatalf("Expected the client's result to be wiped, got %s", mockClient.MockedGetResult.SecretBinary)
+		}
+
+		_ = secretCache.Close()
+	}
+}
+
+func TestSecureMemoryKeepsHookResult(t *testing.T) {
+	mockClient := newBinarySecretClient()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(mockClient),
+		secretcache.WithSecureMemory(false),
+		secretcache.WithHook(&DummyCacheHook{}),
+	)
+	defer secretCache.Close()
+
+	if _, err := secretCache.GetSecretBinary("dummy-secret-name"); err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if string(mockClient.MockedGetResult.SecretBinary) != "my secret binary" {
+		t.Fatalf("Expected the result the hook may keep to be left alone, got %s", mockClient.MockedGetResult.SecretBinary)
+	}
+}
+
+func TestSecureMemorySecretString(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(&mockClient),
+		secretcache.WithSecureMemory(true),
+	)
+	defer secretCache.Close()
+
+	for i := 0; i < 2; i++ {
+		value, err := secretCache.GetSecretString(secretId)
+		if err != nil {
+			t.Fatalf("Unexpected error - %s", err.Error())
+		}
+
+		if value != secretString {
+			t.Fatalf("Expected %s, got %s", secretString, value)
+		}
+	}
+
+	if _, err := secretCache.GetSecretBinary(secretId); err == nil {
+		t.Fatalf("Expected an error for a secret without a binary")
+	}
+}
+
+func TestBorrowSecretWipedOnClose(t *testing.T) {
+	secretCache, _ := secretcache.New(
+		secretcache.WithClient(newBinarySecretClient()),
+		secretcache.WithSecureMemory(false),
+	)
+
+	// Retained only to check that it gets wiped.
+	var borrowed []byte
+	err := secretCache.BorrowSecret(context.Background(), "dummy-secret-name", func(secret []byte) error {
+		borrowed = secret
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error - %s", err.Error())
+	}
+
+	if string(borrowed) != "my secret binary" {
+		t.Fatalf("Expected my secret binary, got %s", borrowed)
+	}
+
+	_ = secretCache.Close()
+
+	if !bytes.Equal(borrowed, make([]byte, len(borrowed))) {
+		t.Fatalf("Expected the buffer to be wiped, got %s", borrowed)
+	}
+}
+
+func TestBorrowSecretCopyWipedAfterUse(t *testing.T) {
+	mockClient, secretId, secretString := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	var borrowed []byte
+	_ = secretCache.BorrowSecret(context.Background(), secretId, func(secret []byte) error {
+		if string(secret) != secretString {
+			t.Fatalf("Expected %s, got %s", secretString, secret)
+		}
+		borrowed = secret
+		return nil
+	})
+
+	if !bytes.Equal(borrowed, make([]byte, len(borrowed))) {
+		t.Fatalf("Expected the copy to be wiped, got %s", borrowed)
+	}
+
+	if value, _ := secretCache.GetSecretString(secretId); value != secretString {
+		t.Fatalf("Expected the cached value to be unchanged, got %s", value)
+	}
+}
+
+func TestBorrowSecretErrors(t *testing.T) {
+	mockClient, secretId, _ := newMockedClientWithDummyResults()
+	secretCache, _ := secretcache.New(secretcache.WithClient(&mockClient))
+
+	fnErr := errors.New("fn failed")
+	err := secretCache.BorrowSecret(context.Background(), secretId, func([]byte) error { return fnErr })
+
+	if !errors.Is(err, fnErr) {
+		t.Fatalf("Expected the error returned by fn, got %v", err)
+	}
+
+	called := false
+	err = secretCache.BorrowSecretWithStage(context.Background(), secretId, "NOSUCHSTAGE", func([]byte) error {
+		called = true
+		return nil
+	})
+
+	var notFound *secretcache.VersionNotFoundError
+	if !errors.As(err, &notFound) || called {
+		t.Fatalf("Expected a VersionNotFoundError without calling fn, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You
+// may not use this file except in compliance with the License. A copy of
+// the License is located at
+//
+// http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is
+// distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF
+// ANY KIND, either express or implied. See the License for the specific
+// language governing permissions and limitations under the License.
+
+package secretcache
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the counters of a Cache, for export to a metrics system.
+// Counters only increase over the lifetime of the cache; CircuitState is the
+// state of the circuit breaker when the snapshot was taken.
+type Stats struct {
+	// The number of successful refreshes of secret metadata or version stages.
+	Refreshes uint64
+
+	// The number of failed refreshes of secret metadata or version stages.
+	RefreshErrors uint64
+
+	// The number of lookups of secrets that are scheduled for deletion.
+	DeletedSecretLookups uint64
+
+	// The number of GetSecretValue, DescribeSecret and BatchGetSecretValue calls
+	// sent a second time because the first had not answered within CacheConfig.HedgeDelay.
+	HedgedRequests uint64
+
+	// The number of refreshes that failed because requests were throttled, by
+	// AWS Secrets Manager or by the cache's own rate limit.
+	ThrottledRequests uint64
+
+	// The number of times the circuit breaker opened.
+	CircuitBreakerTrips uint64
+
+	// The number of calls failed by the circuit breaker without calling AWS Secrets Manager.
+	CircuitBreakerRejections uint64
+
+	// The number of secrets and secret versions evicted, for any reason.
+	Evictions uint64
+
+	// The current state of the circuit breaker.  Always CircuitClosed when
+	// CacheConfig.CircuitBreakerThreshold is not set.
+	CircuitState CircuitState
+}
+
+// statCounter identifies one of the counters of cacheStats.
+type statCounter int
+
+const (
+	statRefreshes statCounter = iota
+	statRefreshErrors
+	statDeletedSecretLookups
+	statHedgedRequests
+	statThrottledRequests
+	statCircuitBreakerTrips
+	statCircuitBreakerRejections
+	statEvictions
+	numStatCounters
+)
+
+// cacheStats holds the live counters shared by the objects of a cache.
+// All methods are safe to call on a nil *cacheStats, which counts nothing.
+type cacheStats struct {
+	counters     [numStatCounters]atomic.Uint64
+	circuitState atomic.Int32
+}
+
+// add increments the given counter.
+func (s *cacheStats) add(counter statCounter) {
+	if s != nil {
+		s.counters[counter].Add(1)
+	}
+}
+
+// setCircuitState records the current state of the circuit breaker.
+func (s *cacheStats) setCircuitState(state CircuitState) {
+	if s != nil {
+		s.circuitState.Store(int32(state))
+	}
+}
+
+// snapshot returns the current value of the counters.
+func (s *cacheStats) snapshot() Stats {
+	if s == nil {
+		return Stats{}
+	}
+
+	return Stats{
+		Refreshes:            s.counters[statRefreshes].Load(),
+		RefreshErrors:        s.counters[statRefreshErrors].Load(),
+		DeletedSecretLookups: s.counters[statDeletedSecretLookups].Load(),
+		HedgedRequests:       s.counters[statHedgedRequests].Load(),
+		ThrottledRequests:    s.counters[statThrottledRequests].Load(),
+
+		CircuitBreakerTrips:      s.counters[statCircuitBreakerTrips].Load(),
+		CircuitBreakerRejections: s.counters[statCircuitBreakerRejections].Load(),
+		Evictions:                s.counters[statEvictions].Load(),
+		CircuitState:             CircuitState(s.circuitState.Load()),
+	}
+}